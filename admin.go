@@ -0,0 +1,26 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// authorizeAdmin проверяет токен администратора в заголовке
+// Authorization: Bearer <токен>. Если токен не задан в конфигурации,
+// служебные адреса отключены и отвечают 404. Возвращает false, если
+// ответ уже отправлен.
+func authorizeAdmin(w http.ResponseWriter, r *http.Request, config *Config) bool {
+	if config.AdminToken == "" {
+		http.NotFound(w, r)
+		return false
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		http.Error(w, "Требуется токен администратора", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Параметры шифрования zip по спецификации WinZip AES (AE-2) с ключом
+// AES-256. Такие архивы открывают 7-Zip, WinZip, The Unarchiver и другие
+// архиваторы с поддержкой AES.
+const (
+	zipMethodAES      = 99
+	zipAESExtraID     = 0x9901
+	zipAESStrength256 = 3
+	zipAESKeySize     = 32
+	zipAESSaltSize    = 16
+	zipAESIterations  = 1000
+	zipAESAuthSize    = 10
+)
+
+// writeAESZipFile сжимает данные и добавляет их в архив файлом name,
+// зашифрованным паролем
+func writeAESZipFile(zipWriter *zip.Writer, name string, data []byte, password string, modified time.Time) error {
+	var compressed bytes.Buffer
+	compressor, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := compressor.Write(data); err != nil {
+		return err
+	}
+	if err := compressor.Close(); err != nil {
+		return err
+	}
+
+	// Из пароля и соли выводятся ключ AES, ключ HMAC и два байта проверки пароля
+	salt := make([]byte, zipAESSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("ошибка генерации соли: %w", err)
+	}
+	keys := pbkdf2.Key([]byte(password), salt, zipAESIterations, 2*zipAESKeySize+2, sha1.New)
+	block, err := aes.NewCipher(keys[:zipAESKeySize])
+	if err != nil {
+		return err
+	}
+
+	// AES в режиме CTR со счетчиком little-endian, начиная с 1
+	encrypted := compressed.Bytes()
+	var counter, stream [aes.BlockSize]byte
+	for offset := 0; offset < len(encrypted); offset += aes.BlockSize {
+		for i := range counter {
+			counter[i]++
+			if counter[i] != 0 {
+				break
+			}
+		}
+		block.Encrypt(stream[:], counter[:])
+		for i := 0; i < aes.BlockSize && offset+i < len(encrypted); i++ {
+			encrypted[offset+i] ^= stream[i]
+		}
+	}
+	mac := hmac.New(sha1.New, keys[zipAESKeySize:2*zipAESKeySize])
+	mac.Write(encrypted)
+
+	// Дополнительное поле AES: версия AE-2, производитель AE, длина ключа
+	// и исходный метод сжатия
+	extra := make([]byte, 11)
+	binary.LittleEndian.PutUint16(extra[0:], zipAESExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], 7)
+	binary.LittleEndian.PutUint16(extra[4:], 2)
+	copy(extra[6:], "AE")
+	extra[8] = zipAESStrength256
+	binary.LittleEndian.PutUint16(extra[9:], zip.Deflate)
+
+	header := &zip.FileHeader{
+		Name:   name,
+		Method: zipMethodAES,
+		// Бит 0 — файл зашифрован, бит 11 — имя в UTF-8. В AE-2 контрольная
+		// сумма не записывается: целостность проверяет HMAC.
+		Flags:              0x1 | 0x800,
+		Extra:              extra,
+		CompressedSize64:   uint64(zipAESSaltSize + 2 + len(encrypted) + zipAESAuthSize),
+		UncompressedSize64: uint64(len(data)),
+		ModifiedDate:       uint16((modified.Year()-1980)<<9 | int(modified.Month())<<5 | modified.Day()),
+		ModifiedTime:       uint16(modified.Hour()<<11 | modified.Minute()<<5 | modified.Second()/2),
+	}
+	writer, err := zipWriter.CreateRaw(header)
+	if err != nil {
+		return fmt.Errorf("не удалось создать файл в архиве: %w", err)
+	}
+	for _, part := range [][]byte{salt, keys[2*zipAESKeySize:], encrypted, mac.Sum(nil)[:zipAESAuthSize]} {
+		if _, err := writer.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,10 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
 	"sync"
 
 	"github.com/gordonklaus/portaudio"
@@ -17,41 +16,47 @@ const (
 	bitsPerSample = 16
 )
 
-// AudioRecorder управляет записью аудио
+// AudioRecorder управляет записью аудио и сохраняет записи в хранилище
 type AudioRecorder struct {
 	recordings map[string]*Recording
+	storage    Storage
 	mu         sync.Mutex
 }
 
+// audioStream — поток, из которого идет запись
+type audioStream interface {
+	Stop() error
+	Close() error
+}
+
 // Recording представляет активную запись аудио
 type Recording struct {
-	stream     *portaudio.Stream
+	stream     audioStream
 	buffer     []int16
 	bufferLock sync.Mutex
-	filePath   string
+	key        string
 	stopChan   chan struct{}
+	// done закрывается, когда запись остановлена и сохранена в хранилище
+	done       chan struct{}
 }
 
 // NewAudioRecorder создает новый аудио рекордер
-func NewAudioRecorder() *AudioRecorder {
+func NewAudioRecorder(storage Storage) *AudioRecorder {
 	// Инициализация portaudio
 	if err := portaudio.Initialize(); err != nil {
 		log.Fatalf("Ошибка инициализации portaudio: %v", err)
 	}
 
-	// Создаем директорию для загрузок, если она не существует
-	if err := os.MkdirAll("uploads", 0755); err != nil {
-		log.Fatalf("Не удалось создать директорию uploads: %v", err)
-	}
-
 	return &AudioRecorder{
 		recordings: make(map[string]*Recording),
+		storage:    storage,
 		mu:         sync.Mutex{},
 	}
 }
 
-// StartRecording начинает запись аудио для сессии
-func (ar *AudioRecorder) StartRecording(sessionID, filePath string) error {
+// StartRecording начинает запись аудио для сессии; запись сохраняется
+// в хранилище по ключу key
+func (ar *AudioRecorder) StartRecording(sessionID, key string) error {
 	ar.mu.Lock()
 	defer ar.mu.Unlock()
 
@@ -60,17 +65,12 @@ func (ar *AudioRecorder) StartRecording(sessionID, filePath string) error {
 		return fmt.Errorf("запись для сессии %s уже запущена", sessionID)
 	}
 
-	// Создаем директорию для файла, если нужно
-	dir := filepath.Dir(filePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("не удалось создать директорию %s: %w", dir, err)
-	}
-
 	// Инициализируем запись
 	recording := &Recording{
 		buffer:   make([]int16, 0),
-		filePath: filePath,
+		key:      key,
 		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
 	}
 
 	// Открываем поток аудио
@@ -78,8 +78,7 @@ func (ar *AudioRecorder) StartRecording(sessionID, filePath string) error {
 	outputChannels := 0 // Нам не нужен выходной канал
 	framesPerBuffer := 1024
 
-	var err error
-	recording.stream, err = portaudio.OpenDefaultStream(
+	stream, err := portaudio.OpenDefaultStream(
 		inputChannels, outputChannels, float64(sampleRate),
 		framesPerBuffer, recording.processAudio,
 	)
@@ -88,29 +87,35 @@ func (ar *AudioRecorder) StartRecording(sessionID, filePath string) error {
 	}
 
 	// Запускаем поток
-	if err := recording.stream.Start(); err != nil {
-		recording.stream.Close()
+	if err := stream.Start(); err != nil {
+		stream.Close()
 		return fmt.Errorf("не удалось запустить аудио поток: %w", err)
 	}
+	recording.stream = stream
 
 	// Сохраняем запись
 	ar.recordings[sessionID] = recording
 
 	// Запускаем горутину для обработки запроса на остановку
-	go func() {
-		<-recording.stopChan
-		recording.stream.Stop()
-		recording.stream.Close()
-
-		// Сохраняем файл WAV
-		if err := ar.saveWavFile(recording); err != nil {
-			log.Printf("Ошибка сохранения WAV файла: %v", err)
-		}
-	}()
+	go ar.finish(recording)
 
 	return nil
 }
 
+// finish ждет остановки записи, закрывает поток и сохраняет файл WAV
+func (ar *AudioRecorder) finish(recording *Recording) {
+	defer close(recording.done)
+
+	<-recording.stopChan
+	recording.stream.Stop()
+	recording.stream.Close()
+
+	// Сохраняем файл WAV
+	if err := ar.saveWavFile(recording); err != nil {
+		log.Printf("Ошибка сохранения WAV файла: %v", err)
+	}
+}
+
 // processAudio обрабатывает входящие аудио данные
 func (r *Recording) processAudio(in []int16) {
 	r.bufferLock.Lock()
@@ -120,7 +125,8 @@ func (r *Recording) processAudio(in []int16) {
 	r.buffer = append(r.buffer, in...)
 }
 
-// StopRecording останавливает запись аудио
+// StopRecording останавливает запись аудио и ждет, пока она будет
+// сохранена в хранилище
 func (ar *AudioRecorder) StopRecording(sessionID string) error {
 	ar.mu.Lock()
 	recording, exists := ar.recordings[sessionID]
@@ -133,26 +139,23 @@ func (ar *AudioRecorder) StopRecording(sessionID string) error {
 	delete(ar.recordings, sessionID)
 	ar.mu.Unlock()
 	
-	// Отправляем сигнал остановки
+	// Отправляем сигнал остановки и ждем сохранения записи
 	close(recording.stopChan)
+	<-recording.done
 	
 	return nil
 }
 
-// saveWavFile сохраняет буфер аудио в WAV файл
+// saveWavFile сохраняет буфер аудио в хранилище в формате WAV
 func (ar *AudioRecorder) saveWavFile(recording *Recording) error {
 	recording.bufferLock.Lock()
 	defer recording.bufferLock.Unlock()
 	
-	// Открываем файл для записи
-	file, err := os.Create(recording.filePath)
-	if err != nil {
-		return fmt.Errorf("не удалось создать файл %s: %w", recording.filePath, err)
-	}
-	defer file.Close()
+	// Запись уже находится в памяти, поэтому WAV формируется в буфере
+	var file bytes.Buffer
 	
 	// Создаем WAV писателя
-	writer := wav.NewWriter(file, uint32(len(recording.buffer)),
+	writer := wav.NewWriter(&file, uint32(len(recording.buffer)),
 		uint16(numChannels), uint32(sampleRate), uint16(bitsPerSample))
 	
 	// Преобразуем int16 данные в байты
@@ -166,7 +169,7 @@ func (ar *AudioRecorder) saveWavFile(recording *Recording) error {
 		return fmt.Errorf("ошибка записи WAV семплов: %w", err)
 	}
 	
-	return nil
+	return ar.storage.Put(recording.key, &file)
 }
 
 // Cleanup освобождает ресурсы
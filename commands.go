@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"filippo.io/age"
+)
+
+// runCommand выполняет служебную команду, заданную первым аргументом после
+// флагов. Возвращает false, если команда не задана и нужно запустить сервер.
+func runCommand(args []string, configPath string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	switch args[0] {
+	case "schema":
+		return true, runSchema(args[1:])
+	case "validate":
+		return true, runValidate(args[1:], configPath)
+	case "decrypt":
+		return true, runDecrypt(args[1:])
+	case "respondent":
+		return true, runRespondent(args[1:], configPath)
+	default:
+		return true, fmt.Errorf("неизвестная команда %s; доступные команды: schema, validate, decrypt, respondent", args[0])
+	}
+}
+
+// runSchema выводит JSON Schema конфигурации или определения опроса:
+//
+//	survey-voice-recorder schema [config|survey]
+func runSchema(args []string) error {
+	target := "config"
+	if len(args) > 0 {
+		target = args[0]
+	}
+	return WriteSchema(os.Stdout, target)
+}
+
+// runValidate проверяет конфигурацию и определения опросов и выводит все
+// найденные проблемы. Завершается с ошибкой, если найдены ошибки, а с
+// флагом -strict — и при одних предупреждениях:
+//
+//	survey-voice-recorder [-config path] validate [-strict] [path]
+func runValidate(args []string, configPath string) error {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	strict := flags.Bool("strict", false, "Считать предупреждения ошибками")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		configPath = flags.Arg(0)
+	}
+
+	diagnostics := LintConfig(configPath)
+	var errorCount, warningCount int
+	for _, d := range diagnostics {
+		fmt.Println(d)
+		if d.Warning {
+			warningCount++
+		} else {
+			errorCount++
+		}
+	}
+	if errorCount > 0 || (*strict && warningCount > 0) {
+		return fmt.Errorf("найдено ошибок: %d, предупреждений: %d", errorCount, warningCount)
+	}
+
+	if warningCount > 0 {
+		fmt.Printf("%s: ошибок не найдено, предупреждений: %d\n", configPath, warningCount)
+		return nil
+	}
+	fmt.Printf("%s: проблем не найдено\n", configPath)
+	return nil
+}
+
+// runDecrypt расшифровывает файлы результатов закрытым ключом age.
+// Расшифрованный файл записывается без суффикса .age рядом с исходным или в
+// директорию -out; в архивах результатов расшифровываются и вложенные файлы:
+//
+//	survey-voice-recorder decrypt -identity key.txt [-out dir] file.age...
+func runDecrypt(args []string) error {
+	flags := flag.NewFlagSet("decrypt", flag.ContinueOnError)
+	identityPath := flags.String("identity", "", "Файл с закрытым ключом age")
+	outDir := flags.String("out", "", "Директория для расшифрованных файлов")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *identityPath == "" || flags.NArg() == 0 {
+		return fmt.Errorf("использование: decrypt -identity key.txt [-out dir] file.age...")
+	}
+
+	keyFile, err := os.Open(*identityPath)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть файл ключа: %w", err)
+	}
+	identities, err := age.ParseIdentities(keyFile)
+	keyFile.Close()
+	if err != nil {
+		return fmt.Errorf("ошибка чтения файла ключа %s: %w", *identityPath, err)
+	}
+
+	for _, file := range flags.Args() {
+		target, err := DecryptFile(file, *outDir, identities)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s -> %s\n", file, target)
+	}
+	return nil
+}
+
+// runRespondent выполняет запрос респондента к данным в хранилище: выводит
+// опись данных, выгружает их в zip-архив или удаляет с записью Tombstone.
+// Сессии в памяти работающего сервера команде недоступны, для них
+// используется /admin/respondent:
+//
+//	survey-voice-recorder respondent list|export|delete (-session id | -respondent email) [-out file.zip] [-reason text]
+func runRespondent(args []string, configPath string) error {
+	usage := fmt.Errorf("использование: respondent list|export|delete (-session id | -respondent email) [-out file.zip] [-reason text]")
+	if len(args) == 0 {
+		return usage
+	}
+	action := args[0]
+	flags := flag.NewFlagSet("respondent", flag.ContinueOnError)
+	sessionID := flags.String("session", "", "ID сессии")
+	respondent := flags.String("respondent", "", "Email или телефон респондента из ответов")
+	out := flags.String("out", "", "Файл архива для export")
+	reason := flags.String("reason", "", "Причина удаления для журнала аудита")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if action == "export" && *out == "" {
+		return usage
+	}
+	if action != "list" && action != "export" && action != "delete" {
+		return usage
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки конфигурации: %w", err)
+	}
+	storage, err := NewStorage(config.Storage)
+	if err != nil {
+		return fmt.Errorf("ошибка подключения хранилища: %w", err)
+	}
+	responseHandler := NewResponseHandler(storage, config.Storage.Prefixes, config.RespondentKey)
+
+	data, err := responseHandler.FindRespondent(RespondentQuery{SessionID: *sessionID, Respondent: *respondent})
+	if err != nil {
+		return err
+	}
+	if len(data.Artifacts) == 0 && len(data.Aggregates) == 0 {
+		return errRespondentNotFound
+	}
+
+	var result interface{} = data
+	switch action {
+	case "export":
+		file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("не удалось создать %s: %w", *out, err)
+		}
+		if err := responseHandler.WriteRespondentBundle(file, data, nil); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		fmt.Printf("Данные сессий %v сохранены в %s\n", data.Sessions, *out)
+		return nil
+	case "delete":
+		if result, err = responseHandler.EraseRespondent(data, *reason); err != nil {
+			return err
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
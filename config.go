@@ -2,18 +2,56 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"filippo.io/age"
 )
 
 // Config представляет основную конфигурацию приложения
 type Config struct {
+	// Email задает получателя и отправителя по умолчанию для всех опросов
 	Email     EmailConfig    `json:"email"`
-	Questions []QuestionData `json:"questions"`
+	// Questions задает опрос по умолчанию, доступный по адресу /survey
+	Questions []QuestionData `json:"questions,omitempty"`
+	Export    ExportConfig   `json:"export,omitempty"`
+	// RandomizeQuestions включает перемешивание порядка вопросов для каждой сессии
+	RandomizeQuestions bool `json:"randomize_questions,omitempty"`
+	// Version задает версию опроса по умолчанию
+	Version string `json:"version,omitempty"`
+	// SurveysDir указывает директорию с определениями дополнительных опросов
+	SurveysDir string `json:"surveys_dir,omitempty"`
+	// Language задает язык текстов опроса по умолчанию (ru, если не указан)
+	Language string `json:"language,omitempty"`
+	// TranslationsDir указывает директорию с переводами интерфейса <язык>.json
+	TranslationsDir string `json:"translations_dir,omitempty"`
 	SMTPHost  string         `json:"smtp_host"`
 	SMTPPort  int            `json:"smtp_port"`
 	SMTPUser  string         `json:"smtp_user"`
-	SMTPPass  string         `json:"smtp_pass"`
+	SMTPPass  string         `json:"smtp_pass" secret:"true"`
+	// AdminToken включает служебные адреса /admin/ и задает токен доступа к ним
+	AdminToken string `json:"admin_token,omitempty" secret:"true"`
+	// RespondentKey — секретный ключ HMAC, которым хешируются email и телефоны
+	// респондентов в журнале доставки для поиска их данных; без ключа поиск
+	// по email и телефону недоступен
+	RespondentKey string `json:"respondent_key,omitempty" secret:"true"`
+	// Storage задает хранилище ответов, аудиозаписей и архивов результатов
+	Storage StorageConfig `json:"storage,omitempty"`
+	// Retention задает срок хранения файлов сессий после отправки
+	Retention RetentionConfig `json:"retention,omitempty"`
+	// Timezone — часовой пояс IANA (например, Europe/Moscow), в котором
+	// разбираются ответы datetime без пояса; по умолчанию пояс сервера
+	Timezone string `json:"timezone,omitempty"`
+
+	// Surveys содержит все загруженные опросы, включая опрос по умолчанию
+	Surveys []*Survey `json:"-"`
+	// Catalog содержит переводы интерфейса: встроенные и из TranslationsDir
+	Catalog Catalog `json:"-"`
 }
 
 // EmailConfig содержит настройки получателя email
@@ -21,6 +59,70 @@ type EmailConfig struct {
 	To      string `json:"to"`
 	From    string `json:"from"`
 	Subject string `json:"subject"`
+	// Encryption задает шифрование архива, прикладываемого к письму
+	Encryption EmailEncryption `json:"encryption,omitempty"`
+}
+
+// Способы шифрования архива в письме
+const (
+	EmailEncryptionNone = "none"
+	EmailEncryptionAge  = "age"
+	EmailEncryptionZip  = "zip"
+)
+
+// emailEncryptionMethods перечисляет поддерживаемые способы шифрования
+var emailEncryptionMethods = []string{EmailEncryptionNone, EmailEncryptionAge, EmailEncryptionZip}
+
+// EmailEncryption задает шифрование архива для получателя письма
+type EmailEncryption struct {
+	// Method — способ шифрования: none (по умолчанию), age — открытыми
+	// ключами получателя, zip — zip-архив AES-256 с паролем
+	Method string `json:"method,omitempty"`
+	// Recipients — открытые ключи age получателя для способа age
+	Recipients []string `json:"recipients,omitempty"`
+	// Password — пароль архива для способа zip; передается получателю
+	// отдельно от писем
+	Password string `json:"password,omitempty" secret:"true"`
+}
+
+// ExportConfig содержит настройки экспорта ответов
+type ExportConfig struct {
+	// OptionFormat определяет, что выгружается для выбранных вариантов:
+	// код (value), подпись (label) или и то и другое (both)
+	OptionFormat string `json:"option_format,omitempty"`
+	// Formats перечисляет форматы выгрузки ответов: csv, json, jsonl и xlsx.
+	// По умолчанию используются csv, json и jsonl.
+	Formats []string `json:"formats,omitempty"`
+}
+
+// Режимы выгрузки вариантов ответа
+const (
+	OptionFormatValue = "value"
+	OptionFormatLabel = "label"
+	OptionFormatBoth  = "both"
+)
+
+// Форматы выгрузки ответов: CSV, JSON и книга Excel для каждой сессии и
+// общий журнал JSONL, в который дописывается строка на каждую отправку
+const (
+	ExportFormatCSV   = "csv"
+	ExportFormatJSON  = "json"
+	ExportFormatJSONL = "jsonl"
+	ExportFormatXLSX  = "xlsx"
+)
+
+// exportFormats перечисляет поддерживаемые форматы выгрузки
+var exportFormats = []string{ExportFormatCSV, ExportFormatJSON, ExportFormatJSONL, ExportFormatXLSX}
+
+// defaultExportFormats используются, если форматы не заданы в конфигурации
+var defaultExportFormats = []string{ExportFormatCSV, ExportFormatJSON, ExportFormatJSONL}
+
+// enabled проверяет, включен ли формат выгрузки
+func (e ExportConfig) enabled(format string) bool {
+	if len(e.Formats) == 0 {
+		return contains(defaultExportFormats, format)
+	}
+	return contains(e.Formats, format)
 }
 
 // QuestionType определяет тип вопроса
@@ -31,81 +133,437 @@ const (
 	TypeMultiChoice  QuestionType = "multi_choice"
 	TypeText         QuestionType = "text"
 	TypeMixed        QuestionType = "mixed"
+	TypeMatrix       QuestionType = "matrix"
+	TypeNumber       QuestionType = "number"
+	TypeDate         QuestionType = "date"
+	TypeDateTime     QuestionType = "datetime"
+	TypeEmail        QuestionType = "email"
+	TypePhone        QuestionType = "phone"
+	TypeRanking      QuestionType = "ranking"
+	TypeFileUpload   QuestionType = "file_upload"
 )
 
+// defaultMaxFileSize ограничивает размер загружаемого файла, если он не задан в конфигурации
+const defaultMaxFileSize = 10 << 20
+
 // QuestionData представляет структуру вопроса
 type QuestionData struct {
 	ID          string       `json:"id"`
 	Text        string       `json:"text"`
 	Type        QuestionType `json:"type"`
-	Options     []string     `json:"options,omitempty"`
+	Options     []Option     `json:"options,omitempty"`
 	AllowCustom bool         `json:"allow_custom,omitempty"`
 	Required    bool         `json:"required"`
+	// RandomizeOptions включает перемешивание вариантов ответа для каждой сессии
+	RandomizeOptions bool `json:"randomize_options,omitempty"`
+
+	// Параметры матричного вопроса: строки оцениваются по общей шкале столбцов
+	Rows        []string `json:"rows,omitempty"`
+	Columns     []Option `json:"columns,omitempty"`
+	MultiSelect bool     `json:"multi_select,omitempty"`
+
+	// Ограничения числового вопроса
+	Min  *float64 `json:"min,omitempty"`
+	Max  *float64 `json:"max,omitempty"`
+	Step float64  `json:"step,omitempty"`
+	Unit string   `json:"unit,omitempty"`
+
+	// Ограничения вопроса с загрузкой файлов
+	AllowedTypes []string `json:"allowed_types,omitempty"`
+	MaxFileSize  int64    `json:"max_file_size,omitempty"`
+	MaxFiles     int      `json:"max_files,omitempty"`
+
+	// Оформление вопроса: ответ по умолчанию, подсказка в поле ввода,
+	// пояснение под вопросом (с простой разметкой) и изображение
+	Default     DefaultValue `json:"default,omitempty"`
+	Placeholder string       `json:"placeholder,omitempty"`
+	HelpText    string       `json:"help_text,omitempty"`
+	Image       string       `json:"image,omitempty"`
+
+	// Translations задает переводы текстов вопроса: язык → перевод
+	Translations map[string]QuestionTranslation `json:"translations,omitempty"`
+
+	// location — часовой пояс ответов datetime из настройки timezone
+	location *time.Location
 }
 
-// LoadConfig загружает конфигурацию из JSON файла
-func LoadConfig(path string) (*Config, error) {
-	file, err := os.Open(path)
+// DefaultValue — ответ, выбранный или введенный заранее. В конфигурации
+// задается строкой, числом или списком (для вопросов с несколькими ответами).
+type DefaultValue []string
+
+// UnmarshalJSON поддерживает запись одного значения без списка
+func (d *DefaultValue) UnmarshalJSON(data []byte) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		items = []json.RawMessage{data}
+	}
+	values := make(DefaultValue, len(items))
+	for i, item := range items {
+		var text string
+		if err := json.Unmarshal(item, &text); err == nil {
+			values[i] = text
+			continue
+		}
+		var number json.Number
+		if err := json.Unmarshal(item, &number); err != nil {
+			return fmt.Errorf("значение по умолчанию должно быть строкой, числом или списком")
+		}
+		values[i] = number.String()
+	}
+	*d = values
+	return nil
+}
+
+// IsDefault проверяет, выбран ли вариант ответа по умолчанию
+func (q QuestionData) IsDefault(value string) bool {
+	return contains(q.Default, value)
+}
+
+// timezone возвращает часовой пояс, в котором разбирается ответ datetime
+func (q QuestionData) timezone() *time.Location {
+	if q.location == nil {
+		return time.Local
+	}
+	return q.location
+}
+
+// location возвращает часовой пояс из настройки timezone. Настройка
+// проверяется при загрузке, поэтому неизвестный пояс заменяется поясом сервера.
+func (c *Config) location() *time.Location {
+	if c.Timezone == "" {
+		return time.Local
+	}
+	location, err := time.LoadLocation(c.Timezone)
 	if err != nil {
-		return nil, fmt.Errorf("невозможно открыть файл конфигурации: %w", err)
+		return time.Local
+	}
+	return location
+}
+
+// DefaultInput возвращает значение по умолчанию для поля ввода. Дата и время
+// приводятся к формату поля datetime-local.
+func (q QuestionData) DefaultInput() string {
+	if len(q.Default) == 0 {
+		return ""
+	}
+	if q.Type == TypeDateTime {
+		if value, err := parseTypedAnswer(q, q.Default[0]); err == nil {
+			return value.(time.Time).Format("2006-01-02T15:04")
+		}
+	}
+	return q.Default[0]
+}
+
+// Option представляет вариант ответа. Value — стабильный код, который
+// сохраняется и выгружается, Label — текст, который видит респондент.
+// В конфигурации вариант задается строкой или объектом {"value", "label", "pin"}.
+type Option struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	// Pin оставляет вариант в конце списка при перемешивании (например, «Другое»)
+	Pin bool `json:"pin,omitempty"`
+}
+
+// UnmarshalJSON поддерживает запись варианта простой строкой или числом
+// (например, шкала 1–5 в YAML)
+func (o *Option) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		o.Value, o.Label = text, text
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err == nil {
+		o.Value, o.Label = number.String(), number.String()
+		return nil
+	}
+
+	type plainOption Option
+	var opt plainOption
+	if err := json.Unmarshal(data, &opt); err != nil {
+		return fmt.Errorf("вариант ответа должен быть строкой или объектом {value, label, pin}: %w", err)
+	}
+	if opt.Label == "" {
+		opt.Label = opt.Value
+	}
+	*o = Option(opt)
+	return nil
+}
+
+// optionValues возвращает коды вариантов ответа
+func optionValues(options []Option) []string {
+	values := make([]string, len(options))
+	for i, o := range options {
+		values[i] = o.Value
+	}
+	return values
+}
+
+// optionLabel возвращает подпись варианта по его коду.
+// Значения, не найденные среди вариантов (свой вариант), возвращаются как есть.
+func optionLabel(options []Option, value string) string {
+	for _, o := range options {
+		if o.Value == value {
+			return o.Label
+		}
+	}
+	return value
+}
+
+// ItemID возвращает ID элемента составного вопроса с индексом i:
+// строки матрицы или варианта ранжирования
+func (q QuestionData) ItemID(i int) string {
+	return fmt.Sprintf("%s_%d", q.ID, i+1)
+}
+
+// AcceptTypes возвращает значение атрибута accept для поля загрузки файлов
+func (q QuestionData) AcceptTypes() string {
+	return strings.Join(q.AllowedTypes, ",")
+}
+
+// UploadLimit возвращает максимальный размер одного загружаемого файла в байтах
+func (q QuestionData) UploadLimit() int64 {
+	if q.MaxFileSize > 0 {
+		return q.MaxFileSize
+	}
+	return defaultMaxFileSize
+}
+
+// UploadLimitMB возвращает максимальный размер файла в мегабайтах для отображения
+func (q QuestionData) UploadLimitMB() int64 {
+	return (q.UploadLimit() + 1<<20 - 1) >> 20
+}
+
+// FileLimit возвращает максимальное количество файлов в ответе
+func (q QuestionData) FileLimit() int {
+	if q.MaxFiles > 0 {
+		return q.MaxFiles
+	}
+	return 1
+}
+
+// Survey возвращает опрос по ID
+func (c *Config) Survey(id string) (*Survey, bool) {
+	for _, s := range c.Surveys {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// DefaultSurvey возвращает опрос, доступный по адресу /survey: опрос из
+// основного файла конфигурации, а при его отсутствии — первый загруженный
+func (c *Config) DefaultSurvey() *Survey {
+	if s, ok := c.Survey(DefaultSurveyID); ok {
+		return s
 	}
-	defer file.Close()
+	return c.Surveys[0]
+}
+
+// mainSurvey возвращает опрос по умолчанию, заданный вопросами основного файла
+func (c *Config) mainSurvey() *Survey {
+	return &Survey{
+		ID:                 DefaultSurveyID,
+		Email:              c.Email,
+		Questions:          c.Questions,
+		RandomizeQuestions: c.RandomizeQuestions,
+		Version:            c.Version,
+		Language:           c.Language,
+	}
+}
 
+// surveysDir возвращает директорию опросов; относительный путь отсчитывается
+// от директории файла конфигурации configPath
+func (c *Config) surveysDir(configPath string) string {
+	return resolvePath(configPath, c.SurveysDir)
+}
+
+// resolvePath отсчитывает относительный путь из конфигурации от директории
+// файла конфигурации configPath
+func resolvePath(configPath, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(configPath), path)
+}
+
+// LoadConfig загружает конфигурацию из файла JSON, YAML или TOML (формат
+// определяется по расширению). Любое скалярное поле
+// может быть переопределено переменной окружения SURVEY_<ПОЛЕ> или прочитано
+// из файла, указанного в SURVEY_<ПОЛЕ>_FILE (см. applyEnvOverrides).
+func LoadConfig(path string) (*Config, error) {
 	var config Config
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
-		return nil, fmt.Errorf("ошибка декодирования JSON: %w", err)
+	if err := decodeConfigFile(path, &config); err != nil {
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			return nil, fmt.Errorf("невозможно открыть файл конфигурации: %w", err)
+		}
+		return nil, err
+	}
+
+	if err := applyEnvOverrides(&config, os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	// Вопросы из основного файла образуют опрос по умолчанию
+	if len(config.Questions) > 0 {
+		config.Surveys = append(config.Surveys, config.mainSurvey())
+	}
+
+	if config.SurveysDir != "" {
+		surveys, err := LoadSurveys(config.surveysDir(path), config.Email)
+		if err != nil {
+			return nil, err
+		}
+		config.Surveys = append(config.Surveys, surveys...)
 	}
 
 	if err := validateConfig(&config); err != nil {
 		return nil, err
 	}
 
+	catalog, err := LoadCatalog(resolvePath(path, config.TranslationsDir))
+	if err != nil {
+		return nil, err
+	}
+	config.Catalog = catalog
+
+	// Опросы без явной версии получают версию по хешу содержимого
+	for _, survey := range config.Surveys {
+		if survey.Version == "" {
+			survey.Version = survey.contentHash()
+		}
+	}
+
 	return &config, nil
 }
 
 // validateConfig проверяет корректность конфигурации
 func validateConfig(config *Config) error {
-	if config.Email.To == "" {
-		return fmt.Errorf("email получателя не указан")
+	if len(config.Surveys) == 0 {
+		return fmt.Errorf("не задано ни одного опроса: список вопросов пуст и директория опросов не указана")
+	}
+
+	ids := make(map[string]bool)
+	for _, survey := range config.Surveys {
+		if ids[survey.ID] {
+			return fmt.Errorf("опрос %s определен несколько раз", survey.ID)
+		}
+		ids[survey.ID] = true
+		if err := validateSurvey(survey); err != nil {
+			return fmt.Errorf("опрос %s: %w", survey.ID, err)
+		}
 	}
 
-	if config.Email.From == "" {
-		return fmt.Errorf("email отправителя не указан")
+	if problems := settingsProblems(config); len(problems) > 0 {
+		return errors.New(problems[0].Message)
 	}
 
-	if len(config.Questions) == 0 {
-		return fmt.Errorf("список вопросов пуст")
+	return nil
+}
+
+// problem описывает ошибку в конфигурации. Path указывает на поле в файле
+// (например, questions[2].options[1]) и позволяет показать место ошибки.
+type problem struct {
+	Path    string
+	Message string
+}
+
+// settingsProblems проверяет общие настройки, не относящиеся к опросам
+func settingsProblems(config *Config) []problem {
+	var problems []problem
+
+	switch config.Export.OptionFormat {
+	case "", OptionFormatValue, OptionFormatLabel, OptionFormatBoth:
+	default:
+		problems = append(problems, problem{
+			Path:    "export.option_format",
+			Message: fmt.Sprintf("неизвестный режим выгрузки вариантов %s", config.Export.OptionFormat),
+		})
 	}
 
-	for i, q := range config.Questions {
-		if q.ID == "" {
-			return fmt.Errorf("вопрос #%d: отсутствует ID", i+1)
+	for i, format := range config.Export.Formats {
+		if !contains(exportFormats, format) {
+			problems = append(problems, problem{
+				Path:    fmt.Sprintf("export.formats[%d]", i),
+				Message: fmt.Sprintf("неизвестный формат выгрузки %s: допустимы %s", format, strings.Join(exportFormats, ", ")),
+			})
 		}
-		if q.Text == "" {
-			return fmt.Errorf("вопрос #%d: отсутствует текст вопроса", i+1)
+	}
+
+	if config.Timezone != "" {
+		if _, err := time.LoadLocation(config.Timezone); err != nil {
+			problems = append(problems, problem{Path: "timezone", Message: fmt.Sprintf("неизвестный часовой пояс %s", config.Timezone)})
 		}
+	}
 
-		switch q.Type {
-		case TypeSingleChoice, TypeMultiChoice:
-			if len(q.Options) == 0 {
-				return fmt.Errorf("вопрос #%d: тип %s требует наличия вариантов ответа", i+1, q.Type)
-			}
-		case TypeMixed:
-			if len(q.Options) == 0 || !q.AllowCustom {
-				return fmt.Errorf("вопрос #%d: тип mixed требует наличия вариантов ответа и разрешения ввода пользователя", i+1)
+	switch config.Storage.Backend {
+	case "", StorageLocal:
+	case StorageS3:
+		s3 := config.Storage.S3
+		if s3.Bucket == "" {
+			problems = append(problems, problem{Path: "storage.s3.bucket", Message: "не задан бакет S3"})
+		}
+		if s3.AccessKey == "" || s3.SecretKey == "" {
+			problems = append(problems, problem{Path: "storage.s3", Message: "не заданы ключи доступа S3 access_key и secret_key"})
+		}
+		if s3.Endpoint != "" {
+			if u, err := url.Parse(s3.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				problems = append(problems, problem{Path: "storage.s3.endpoint", Message: fmt.Sprintf("некорректный адрес S3 %s", s3.Endpoint)})
 			}
-		case TypeText:
-			// Для текстовых вопросов нет специальных требований
-		default:
-			return fmt.Errorf("вопрос #%d: неизвестный тип %s", i+1, q.Type)
 		}
+	default:
+		problems = append(problems, problem{
+			Path:    "storage.backend",
+			Message: fmt.Sprintf("неизвестный тип хранилища %s: допустимы %s", config.Storage.Backend, strings.Join(storageBackends, ", ")),
+		})
+	}
+
+	for i, key := range config.Storage.Encryption.Recipients {
+		if _, err := age.ParseX25519Recipient(key); err != nil {
+			problems = append(problems, problem{
+				Path:    fmt.Sprintf("storage.encryption.recipients[%d]", i),
+				Message: fmt.Sprintf("некорректный открытый ключ age %s", key),
+			})
+		}
+	}
+
+	if config.RespondentKey != "" && len(config.RespondentKey) < minRespondentKeyLength {
+		problems = append(problems, problem{
+			Path:    "respondent_key",
+			Message: fmt.Sprintf("ключ должен быть не короче %d символов", minRespondentKeyLength),
+		})
+	}
+
+	if config.Retention.DeliveredDays < 0 {
+		problems = append(problems, problem{Path: "retention.delivered_days", Message: "срок хранения не может быть отрицательным"})
+	}
+	if config.Retention.IntervalMinutes < 0 {
+		problems = append(problems, problem{Path: "retention.interval_minutes", Message: "период проверки не может быть отрицательным"})
+	}
+	if config.Retention.MaxAttempts < 0 {
+		problems = append(problems, problem{Path: "retention.max_attempts", Message: "число попыток не может быть отрицательным"})
 	}
 
 	// Проверка SMTP настроек
-	if config.SMTPHost == "" || config.SMTPPort == 0 {
-		return fmt.Errorf("неверные настройки SMTP сервера")
+	if config.SMTPHost == "" {
+		problems = append(problems, problem{Path: "smtp_host", Message: "неверные настройки SMTP сервера"})
+	} else if config.SMTPPort == 0 {
+		problems = append(problems, problem{Path: "smtp_port", Message: "неверные настройки SMTP сервера"})
 	}
 
+	return problems
+}
+
+// registerItemIDs проверяет, что ID элементов составного вопроса не совпадают
+// с другими ID: они попадают в экспорт наравне с ID вопросов
+func registerItemIDs(ids map[string]bool, q QuestionData, count int) error {
+	for i := 0; i < count; i++ {
+		itemID := q.ItemID(i)
+		if ids[itemID] {
+			return fmt.Errorf("ID элемента %s совпадает с другим ID", itemID)
+		}
+		ids[itemID] = true
+	}
 	return nil
 }
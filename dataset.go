@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// datasetMeta — служебные столбцы сводного набора перед столбцами вопросов
+var datasetMeta = []string{"session_id", "survey_version", "language", "started_at", "first_interaction_at", "submitted_at", "duration_seconds", "audio"}
+
+// columnKind определяет тип значений столбца при выгрузке в Excel
+type columnKind int
+
+const (
+	columnText columnKind = iota
+	columnNumber
+	columnDate
+	columnDateTime
+	// columnDuration — длительность в секундах с дробной частью
+	columnDuration
+)
+
+// datasetColumn — столбец сводного набора данных и способ получить его
+// значение из ответов сессии
+type datasetColumn struct {
+	Name string
+	// Question и Type — ID и тип вопроса, к которому относится столбец
+	Question string
+	Type     QuestionType
+	// Label описывает столбец: текст вопроса и, для составных вопросов,
+	// строка матрицы или вариант ответа
+	Label string
+	Kind  columnKind
+	// Options — варианты, коды которых хранятся в столбце
+	Options []Option
+	// Indicator отмечает столбцы 1/0 с выбором одного варианта
+	Indicator bool
+	value     func(session *Session) string
+}
+
+// answerKey сообщает, что имя столбца совпадает с ключом ответа в сессии:
+// ID вопроса или элемента матрицы или рейтинга
+func (c datasetColumn) answerKey() bool {
+	if c.Name == c.Question {
+		return true
+	}
+	if c.Type != TypeMatrix && c.Type != TypeRanking {
+		return false
+	}
+	_, err := strconv.Atoi(strings.TrimPrefix(c.Name, c.Question+"_"))
+	return strings.HasPrefix(c.Name, c.Question+"_") && err == nil
+}
+
+// datasetColumns строит столбцы сводного набора в порядке вопросов опроса:
+// по одному на вопрос, индикатор 1/0 на каждый вариант вопросов с несколькими
+// ответами, столбец на строку матрицы и на вариант рейтинга. После них идут
+// столбцы <id>_dwell со временем работы с каждым вопросом в секундах.
+// Порядок зависит только от определения опроса, поэтому он одинаков для всех
+// сессий версии.
+func datasetColumns(questions []QuestionData, optionFormat string) []datasetColumn {
+	var columns []datasetColumn
+	refs := pipeRefLabels(questions)
+	for _, q := range questions {
+		q := q
+		start := len(columns)
+		switch q.Type {
+		case TypeMultiChoice, TypeMixed:
+			for _, option := range q.Options {
+				column := indicatorColumn(q.ID+"_"+option.Value, q.ID, option.Value)
+				column.Label = q.Text + " — " + option.Label
+				columns = append(columns, column)
+			}
+			if q.Type == TypeMixed {
+				// Свой вариант респондента — все значения не из списка вариантов
+				values := optionValues(q.Options)
+				columns = append(columns, datasetColumn{
+					Name:  q.ID + "_custom",
+					Label: q.Text,
+					value: func(session *Session) string {
+						var custom []string
+						for _, v := range session.Responses[q.ID] {
+							if !contains(values, v) {
+								custom = append(custom, v)
+							}
+						}
+						return strings.Join(custom, "; ")
+					},
+				})
+			}
+		case TypeMatrix:
+			for i, row := range q.Rows {
+				rowID := q.ItemID(i)
+				if !q.MultiSelect {
+					column := choiceColumn(rowID, rowID, q.Columns, optionFormat)
+					column.Label = q.Text + " — " + row
+					columns = append(columns, column)
+					continue
+				}
+				for _, option := range q.Columns {
+					column := indicatorColumn(rowID+"_"+option.Value, rowID, option.Value)
+					column.Label = q.Text + " — " + row + " — " + option.Label
+					columns = append(columns, column)
+				}
+			}
+		case TypeRanking:
+			for i, option := range q.Options {
+				option := option
+				columns = append(columns, datasetColumn{
+					Name:  q.ItemID(i),
+					Label: q.Text + " — " + option.Label,
+					Kind:  columnNumber,
+					value: func(session *Session) string {
+						for pos, v := range session.Responses[q.ID] {
+							if v == option.Value {
+								return strconv.Itoa(pos + 1)
+							}
+						}
+						return ""
+					},
+				})
+			}
+		default:
+			column := choiceColumn(q.ID, q.ID, q.Options, optionFormat)
+			column.Label = q.Text
+			if q.Type == TypeNumber && q.Unit != "" {
+				column.Label += ", " + q.Unit
+			}
+			switch q.Type {
+			case TypeNumber:
+				column.Kind = columnNumber
+			case TypeDate:
+				column.Kind = columnDate
+			case TypeDateTime:
+				column.Kind = columnDateTime
+			}
+			columns = append(columns, column)
+		}
+
+		for i := start; i < len(columns); i++ {
+			columns[i].Question, columns[i].Type = q.ID, q.Type
+			columns[i].Label = pipeText(columns[i].Label, refs)
+		}
+	}
+
+	for _, q := range questions {
+		q := q
+		columns = append(columns, datasetColumn{
+			Name:     q.ID + "_dwell",
+			Question: q.ID,
+			Label:    pipeText(q.Text, refs) + " — время на вопрос, с",
+			Kind:     columnDuration,
+			value: func(session *Session) string {
+				timing, ok := session.Timings[q.ID]
+				if !ok {
+					return ""
+				}
+				return strconv.FormatFloat(timing.Dwell.Seconds(), 'f', 1, 64)
+			},
+		})
+	}
+	return columns
+}
+
+// choiceColumn возвращает столбец с ответом на вопрос. Для вариантов ответа
+// выгружаются коды или подписи в зависимости от option_format.
+func choiceColumn(name, id string, options []Option, optionFormat string) datasetColumn {
+	return datasetColumn{
+		Name:    name,
+		Options: options,
+		value: func(session *Session) string {
+			values := session.Responses[id]
+			if optionFormat == OptionFormatLabel {
+				values = optionLabels(options, values)
+			}
+			return strings.Join(values, "; ")
+		},
+	}
+}
+
+// indicatorColumn возвращает столбец-индикатор выбора варианта value
+func indicatorColumn(name, id, value string) datasetColumn {
+	return datasetColumn{
+		Name:      name,
+		Kind:      columnNumber,
+		Indicator: true,
+		value: func(session *Session) string {
+			if contains(session.Responses[id], value) {
+				return "1"
+			}
+			return "0"
+		},
+	}
+}
+
+// datasetHeader возвращает заголовок сводного набора
+func datasetHeader(columns []datasetColumn) []string {
+	header := append([]string{}, datasetMeta...)
+	for _, column := range columns {
+		header = append(header, column.Name)
+	}
+	return header
+}
+
+// datasetRow возвращает строку сводного набора для сессии
+func datasetRow(columns []datasetColumn, session *Session, record SessionRecord) []string {
+	firstInteraction := ""
+	if record.FirstInteractionAt != nil {
+		firstInteraction = record.FirstInteractionAt.Format(time.RFC3339)
+	}
+	row := []string{
+		record.SessionID,
+		record.SurveyVersion,
+		record.Language,
+		record.StartedAt.Format(time.RFC3339),
+		firstInteraction,
+		record.SubmittedAt.Format(time.RFC3339),
+		strconv.FormatFloat(record.DurationSeconds, 'f', 0, 64),
+		record.Audio,
+	}
+	for _, column := range columns {
+		row = append(row, column.value(session))
+	}
+	return row
+}
+
+// datasetKey формирует ключ сводного набора версии опроса
+func (rh *ResponseHandler) datasetKey(surveyID, version string) string {
+	return rh.key(rh.prefixes.Datasets, fmt.Sprintf("dataset_%s_%s.csv", surveyID, version))
+}
+
+// appendDataset дописывает сессию строкой в сводный набор ее версии опроса.
+// Набор создается с заголовком при первой отправке. Если набор начат
+// предыдущей версией программы с другим набором столбцов, строка
+// записывается по его заголовку: значения сопоставляются по имени столбца.
+// Зашифрованный набор прочитать нельзя, поэтому в него строка всегда
+// записывается по текущему набору столбцов.
+func (rh *ResponseHandler) appendDataset(session *Session, record SessionRecord, export ExportConfig) error {
+	key := rh.datasetKey(session.Survey.ID, session.SurveyVersion)
+	columns := datasetColumns(session.Survey.Questions, export.OptionFormat)
+	header := datasetHeader(columns)
+	row := datasetRow(columns, session, record)
+
+	var existing []string
+	if rh.Encrypted() {
+		exists, err := rh.storage.Exists(key)
+		if err != nil {
+			return fmt.Errorf("не удалось проверить набор данных %s: %w", key, err)
+		}
+		if exists {
+			existing = header
+		}
+	} else if body, err := rh.storage.Get(key); err == nil {
+		existing, err = csv.NewReader(body).Read()
+		body.Close()
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("ошибка чтения заголовка набора данных %s: %w", key, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("не удалось открыть набор данных %s: %w", key, err)
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if existing == nil {
+		if err := writer.Write(header); err != nil {
+			return fmt.Errorf("ошибка записи заголовка набора данных: %w", err)
+		}
+	} else if strings.Join(existing, ",") != strings.Join(header, ",") {
+		values := make(map[string]string, len(header))
+		for i, name := range header {
+			values[name] = row[i]
+		}
+		row = make([]string, len(existing))
+		for i, name := range existing {
+			row[i] = values[name]
+		}
+	}
+	if err := writer.Write(row); err != nil {
+		return fmt.Errorf("ошибка записи в набор данных %s: %w", key, err)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("ошибка записи в набор данных %s: %w", key, err)
+	}
+	return rh.storage.Append(key, buf.Bytes())
+}
+
+// errDatasetEncrypted возвращается при чтении зашифрованного набора данных:
+// расшифровать его может только владелец закрытого ключа
+var errDatasetEncrypted = errors.New("набор данных зашифрован")
+
+// loadDataset читает сводный набор версии опроса вместе с определением этой
+// версии из архива версий
+func (rh *ResponseHandler) loadDataset(config *Config, surveyID, version string) (surveyDataset, error) {
+	key := rh.datasetKey(surveyID, version)
+	if rh.Encrypted() {
+		return surveyDataset{}, fmt.Errorf("%w: %s", errDatasetEncrypted, key)
+	}
+	body, err := rh.storage.Get(key)
+	if err != nil {
+		return surveyDataset{}, err
+	}
+	defer body.Close()
+
+	records, err := csv.NewReader(body).ReadAll()
+	if err != nil {
+		return surveyDataset{}, fmt.Errorf("ошибка чтения набора данных %s: %w", key, err)
+	}
+	if len(records) == 0 {
+		return surveyDataset{}, fmt.Errorf("набор данных %s пуст", key)
+	}
+
+	survey, ok := config.Survey(surveyID)
+	if !ok || survey.Version != version {
+		if survey, err = rh.LoadSurveyVersion(surveyID, version); err != nil {
+			return surveyDataset{}, err
+		}
+	}
+	return surveyDataset{Survey: survey, Header: records[0], Rows: records[1:]}, nil
+}
+
+// HandleDataset отдает сводный набор данных:
+//
+//	GET /admin/dataset?survey=<id>&version=<версия>&format=csv|xlsx|spss|r
+//
+// CSV содержит одну версию опроса, по умолчанию текущую версию опроса по
+// умолчанию. Форматы spss и r выгружают ее же zip-архивом с числовыми кодами
+// и файлом синтаксиса. Книга XLSX содержит лист ответов на каждый опрос, кодификатор и
+// лист сессий; без параметра survey в нее попадают текущие версии всех опросов.
+func (sm *SessionManager) HandleDataset(w http.ResponseWriter, r *http.Request) {
+	config := sm.currentConfig()
+	if !authorizeAdmin(w, r, config) {
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = ExportFormatCSV
+	}
+	if !contains([]string{ExportFormatCSV, ExportFormatXLSX, statFormatSPSS, statFormatR}, format) {
+		http.Error(w, "Неизвестный формат: допустимы csv, xlsx, spss и r", http.StatusBadRequest)
+		return
+	}
+
+	surveyIDs := []string{query.Get("survey")}
+	requestedVersion := query.Get("version")
+	switch {
+	case surveyIDs[0] != "":
+	case format == ExportFormatXLSX:
+		// Книга со всеми опросами всегда содержит их текущие версии
+		surveyIDs, requestedVersion = nil, ""
+		for _, survey := range config.Surveys {
+			surveyIDs = append(surveyIDs, survey.ID)
+		}
+	default:
+		surveyIDs[0] = config.DefaultSurvey().ID
+	}
+
+	var datasets []surveyDataset
+	for _, surveyID := range surveyIDs {
+		version := requestedVersion
+		if version == "" {
+			if survey, ok := config.Survey(surveyID); ok {
+				version = survey.Version
+			}
+		}
+		// Параметры входят в путь к файлу, поэтому проверяются так же, как в определениях
+		if !surveyIDPattern.MatchString(surveyID) || !surveyVersionPattern.MatchString(version) {
+			http.Error(w, "Некорректный опрос или версия", http.StatusBadRequest)
+			return
+		}
+
+		dataset, err := sm.responseHandler.loadDataset(config, surveyID, version)
+		if errors.Is(err, os.ErrNotExist) {
+			// В общую книгу попадают только опросы, на которые уже есть ответы
+			if len(surveyIDs) > 1 {
+				continue
+			}
+			http.Error(w, "Набор данных не найден", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, errDatasetEncrypted) {
+			http.Error(w, "Набор данных хранится зашифрованным: скачайте файл из хранилища и расшифруйте командой decrypt", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Ошибка чтения набора данных: %v", err)
+			http.Error(w, "Ошибка чтения набора данных", http.StatusInternalServerError)
+			return
+		}
+		datasets = append(datasets, dataset)
+	}
+	if len(datasets) == 0 {
+		http.Error(w, "Набор данных не найден", http.StatusNotFound)
+		return
+	}
+
+	dataset := datasets[0]
+	switch format {
+	case ExportFormatCSV:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="dataset_%s_%s.csv"`, dataset.Survey.ID, dataset.Survey.Version))
+		writer := csv.NewWriter(w)
+		writer.Write(dataset.Header)
+		writer.WriteAll(dataset.Rows)
+		return
+	case statFormatSPSS, statFormatR:
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="dataset_%s_%s_%s.zip"`, dataset.Survey.ID, dataset.Survey.Version, format))
+		if err := WriteStatExport(w, dataset, config.Export.OptionFormat, format); err != nil {
+			log.Printf("Ошибка выгрузки набора данных: %v", err)
+		}
+		return
+	}
+
+	name := "responses"
+	if len(surveyIDs) == 1 {
+		name = fmt.Sprintf("dataset_%s_%s", datasets[0].Survey.ID, datasets[0].Survey.Version)
+	}
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.xlsx"`, name))
+	if err := WriteXLSX(w, responsesWorkbook(datasets, config.Export.OptionFormat)); err != nil {
+		log.Printf("Ошибка выгрузки набора данных: %v", err)
+	}
+}
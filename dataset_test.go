@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDatasetColumnLabelsReplacePipes(t *testing.T) {
+	questions := []QuestionData{
+		{ID: "fruit", Text: "Фрукт", Type: TypeSingleChoice, Options: []Option{{Value: "a", Label: "Яблоко"}}},
+		{ID: "why", Text: "Почему {{fruit}}?", Type: TypeMultiChoice, Options: []Option{{Value: "x", Label: "Из-за {{ fruit }}"}}},
+	}
+	for _, column := range datasetColumns(questions, OptionFormatValue) {
+		if strings.Contains(column.Label, "{{") {
+			t.Errorf("столбец %s: подстановка в описании %q", column.Name, column.Label)
+		}
+	}
+
+	found := false
+	for _, v := range statVariables(&Survey{ID: "s", Questions: questions}, OptionFormatValue) {
+		if v.Name == "why_x" {
+			found = true
+			if v.Label != "Почему [fruit]? — Из-за [fruit]" {
+				t.Errorf("описание переменной %s: %q", v.Name, v.Label)
+			}
+		}
+	}
+	if !found {
+		t.Error("переменная why_x не найдена")
+	}
+}
+
+func TestDwellColumnIsScale(t *testing.T) {
+	survey := &Survey{ID: "s", Version: "v1", Questions: []QuestionData{
+		{ID: "rk", Text: "Порядок", Type: TypeRanking, Options: []Option{{Value: "a", Label: "A"}, {Value: "b", Label: "B"}}},
+	}}
+	variables := statVariables(survey, OptionFormatValue)
+	syntax := spssSyntax(variables, statRows(variables, surveyDataset{Survey: survey}), survey, "data.csv")
+	if !strings.Contains(syntax, "    rk_dwell F8.2\n") {
+		t.Errorf("формат rk_dwell не F8.2:\n%s", syntax)
+	}
+	if !strings.Contains(syntax, "    rk_1 F8.0\n") {
+		t.Errorf("формат rk_1 не F8.0:\n%s", syntax)
+	}
+	for _, v := range variables {
+		if v.Name == "rk_dwell" && v.Level != levelScale {
+			t.Errorf("уровень rk_dwell %s, ожидался %s", v.Level, levelScale)
+		}
+	}
+}
+
+func TestColumnNameCollisions(t *testing.T) {
+	choice := []Option{{Value: "1", Label: "Один"}, {Value: "2", Label: "Два"}}
+	for _, tc := range []struct {
+		name      string
+		questions []QuestionData
+		problems  int
+	}{
+		{"без совпадений", []QuestionData{
+			{ID: "m", Text: "M", Type: TypeMultiChoice, Options: choice},
+			{ID: "n", Text: "N", Type: TypeText},
+		}, 0},
+		{"индикатор варианта", []QuestionData{
+			{ID: "m", Text: "M", Type: TypeMultiChoice, Options: choice},
+			{ID: "m_1", Text: "M1", Type: TypeText},
+		}, 1},
+		{"время на вопрос", []QuestionData{
+			{ID: "x", Text: "X", Type: TypeText},
+			{ID: "x_dwell", Text: "XD", Type: TypeText},
+		}, 1},
+		{"служебный столбец", []QuestionData{
+			{ID: "language", Text: "L", Type: TypeText},
+		}, 1},
+		{"строка матрицы", []QuestionData{
+			{ID: "m_1", Text: "M1", Type: TypeText},
+			{ID: "m", Text: "M", Type: TypeMatrix, Rows: []string{"r"}, Columns: choice},
+		}, 0},
+	} {
+		if got := len(columnProblems(&Survey{ID: "s", Questions: tc.questions})); got != tc.problems {
+			t.Errorf("%s: найдено проблем %d, ожидалось %d", tc.name, got, tc.problems)
+		}
+	}
+}
+
+func TestDatasetDefaultsToServedSurvey(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.json": `{"smtp_host": "127.0.0.1", "smtp_port": 1, "admin_token": "secret", "surveys_dir": "surveys",
+			"email": {"to": "a@example.com", "from": "a@example.com"}}`,
+		"surveys/feedback.json": `{"questions": [{"id": "name", "text": "Имя", "type": "text"}]}`,
+	}
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config, err := LoadConfig(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewLocalStorage(filepath.Join(dir, "uploads"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := NewSessionManager(config, NewResponseHandler(storage, config.Storage.Prefixes, ""), NewAudioRecorder(storage))
+
+	session := sm.newSession(config.DefaultSurvey())
+	session.Responses = map[string][]string{"name": {"Анна"}}
+	if err := sm.responseHandler.SaveResponses(session, config.Export); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/dataset", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	sm.HandleDataset(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), session.ID) {
+		t.Errorf("набор данных опроса feedback: %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"net/smtp"
-	"os"
-	"path/filepath"
+	"strings"
 	"time"
 
+	"filippo.io/age"
 	"github.com/jordan-wright/email"
 )
 
@@ -23,49 +26,72 @@ func NewEmailer(config *Config) *Emailer {
 	}
 }
 
-// SendZipResults отправляет zip-архив с результатами на email
-func (e *Emailer) SendZipResults(zipPath, sessionID string) error {
-	// Проверяем существование архива
-	if _, err := os.Stat(zipPath); os.IsNotExist(err) {
-		return fmt.Errorf("архив не найден: %w", err)
+// SendZipResults отправляет zip-архив с результатами сессии получателю
+// опроса; name — имя файла архива, contents — описание его содержимого для
+// текста письма. Архив шифруется способом, заданным для получателя, и текст
+// письма сообщает, как его расшифровать.
+func (e *Emailer) SendZipResults(archive io.Reader, name string, contents []string, session *Session) error {
+	sessionID := session.ID
+	recipient := session.Survey.Email
+	// Письмо датируется отправкой ответов, а не отправкой письма: при
+	// повторной доставке они расходятся
+	submitted := session.SubmitTime.Local()
+	if session.SubmitTime.IsZero() {
+		submitted = time.Now()
+	}
+
+	attachment, err := prepareAttachment(archive, name, recipient.Encryption)
+	if err != nil {
+		return err
 	}
 
 	// Создаем новое email сообщение
 	em := email.NewEmail()
-	em.From = e.config.Email.From
-	em.To = []string{e.config.Email.To}
+	em.From = recipient.From
+	em.To = []string{recipient.To}
 	
 	// Формируем тему письма
-	subject := e.config.Email.Subject
+	subject := recipient.Subject
 	if subject == "" {
 		subject = "Результаты опроса"
 	}
+	if session.Survey.ID != DefaultSurveyID {
+		subject = fmt.Sprintf("%s [%s]", subject, session.Survey.ID)
+	}
 	em.Subject = fmt.Sprintf("%s - Сессия %s - %s", 
 		subject, 
 		sessionID[:8], // Используем первые 8 символов ID для краткости
-		time.Now().Format("2006-01-02 15:04"))
+		submitted.Format("2006-01-02 15:04"))
 
 	// Тело письма
 	em.Text = []byte(fmt.Sprintf(`Здравствуйте!
 
 Во вложении находятся результаты опроса, проведенного %s.
 
+Опрос: %s (версия %s)
+Язык: %s
 ID сессии: %s
 Время завершения: %s
 
+%s
+
 В архиве содержатся:
-1. CSV-файл с ответами пользователя
-2. Аудиозапись, сделанная во время прохождения опроса
+%s
 
 С уважением,
 Система автоматического тестирования
 `, 
-		time.Now().Format("02.01.2006 в 15:04"),
+		submitted.Format("02.01.2006 в 15:04"),
+		session.Survey.ID,
+		session.SurveyVersion,
+		session.Language,
 		sessionID,
-		time.Now().Format("02.01.2006 15:04:05")))
+		submitted.Format("02.01.2006 15:04:05"),
+		attachment.notice,
+		numberedList(contents)))
 
 	// Прикрепляем файл архива
-	if _, err := em.AttachFile(zipPath); err != nil {
+	if _, err := em.Attach(bytes.NewReader(attachment.data), attachment.name, attachment.contentType); err != nil {
 		return fmt.Errorf("ошибка прикрепления файла: %w", err)
 	}
 
@@ -78,6 +104,118 @@ ID сессии: %s
 		return fmt.Errorf("ошибка отправки email: %w", err)
 	}
 
-	log.Printf("Email с результатами успешно отправлен на %s", e.config.Email.To)
+	log.Printf("Email с результатами успешно отправлен на %s", recipient.To)
 	return nil
 }
+
+// numberedList нумерует строки списка для текста письма
+func numberedList(items []string) string {
+	lines := make([]string, len(items))
+	for i, item := range items {
+		lines[i] = fmt.Sprintf("%d. %s", i+1, item)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// emailAttachment — вложение с результатами и описание его шифрования для
+// текста письма
+type emailAttachment struct {
+	name        string
+	contentType string
+	data        []byte
+	notice      string
+}
+
+// prepareAttachment шифрует архив результатов способом encryption. Архив,
+// зашифрованный при хранении (с суффиксом .age), шифруется поверх этого.
+func prepareAttachment(archive io.Reader, name string, encryption EmailEncryption) (emailAttachment, error) {
+	data, err := io.ReadAll(archive)
+	if err != nil {
+		return emailAttachment{}, fmt.Errorf("ошибка чтения архива: %w", err)
+	}
+	attachment := emailAttachment{name: name, contentType: "application/zip", data: data}
+
+	var notices []string
+	if strings.HasSuffix(name, encryptedSuffix) {
+		attachment.contentType = "application/octet-stream"
+		notices = append(notices, "Файлы результатов зашифрованы при хранении в формате age ключами исследовательской группы. "+
+			"Расшифруйте архив командой: survey-voice-recorder decrypt -identity key.txt "+name)
+	}
+
+	switch encryption.Method {
+	case EmailEncryptionAge:
+		recipients, err := parseRecipients(encryption.Recipients)
+		if err != nil {
+			return emailAttachment{}, err
+		}
+		var buf bytes.Buffer
+		writer, err := age.Encrypt(&buf, recipients...)
+		if err != nil {
+			return emailAttachment{}, fmt.Errorf("ошибка шифрования архива: %w", err)
+		}
+		if _, err := writer.Write(data); err != nil {
+			return emailAttachment{}, fmt.Errorf("ошибка шифрования архива: %w", err)
+		}
+		if err := writer.Close(); err != nil {
+			return emailAttachment{}, fmt.Errorf("ошибка шифрования архива: %w", err)
+		}
+		attachment.name = name + encryptedSuffix
+		attachment.contentType = "application/octet-stream"
+		attachment.data = buf.Bytes()
+		notices = append(notices, fmt.Sprintf("Вложение зашифровано в формате age открытым ключом получателя. "+
+			"Расшифруйте его закрытым ключом: age -d -i key.txt -o %s %s", name, attachment.name))
+	case EmailEncryptionZip:
+		if attachment.data, err = encryptZipAttachment(name, data, encryption.Password); err != nil {
+			return emailAttachment{}, fmt.Errorf("ошибка шифрования архива: %w", err)
+		}
+		if !strings.HasSuffix(name, ".zip") {
+			attachment.name = name + ".zip"
+		}
+		attachment.contentType = "application/zip"
+		notices = append(notices, "Архив защищен паролем (zip, шифрование AES-256). Пароль передается отдельно; "+
+			"откройте архив в 7-Zip, WinZip или другом архиваторе с поддержкой AES.")
+	}
+
+	if len(notices) == 0 {
+		notices = append(notices, "Архив не зашифрован.")
+	}
+	attachment.notice = strings.Join(notices, "\n")
+	return attachment, nil
+}
+
+// encryptZipAttachment шифрует архив паролем: файлы zip-архива
+// перекладываются в новый архив с шифрованием AES, а другой файл
+// (зашифрованный при хранении архив) помещается в архив целиком
+func encryptZipAttachment(name string, data []byte, password string) ([]byte, error) {
+	modified := time.Now()
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+
+	if strings.HasSuffix(name, ".zip") {
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range archive.File {
+			src, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			content, err := io.ReadAll(src)
+			src.Close()
+			if err != nil {
+				return nil, err
+			}
+			if err := writeAESZipFile(zipWriter, f.Name, content, password, modified); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := writeAESZipFile(zipWriter, name, data, password, modified); err != nil {
+		return nil, err
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// encryptedSuffix добавляется к ключам зашифрованных объектов
+const encryptedSuffix = ".age"
+
+// EncryptionConfig задает шифрование результатов в хранилище. Файлы
+// шифруются в формате age для открытых ключей получателей, поэтому
+// расшифровать их может только владелец закрытого ключа, а сервер после
+// записи прочитать их уже не может.
+type EncryptionConfig struct {
+	// Recipients — открытые ключи age (age1...) исследователей; пустой
+	// список отключает шифрование
+	Recipients []string `json:"recipients,omitempty"`
+}
+
+// enabled сообщает, включено ли шифрование
+func (c EncryptionConfig) enabled() bool {
+	return len(c.Recipients) > 0
+}
+
+// parseRecipients разбирает открытые ключи получателей
+func parseRecipients(keys []string) ([]age.Recipient, error) {
+	recipients := make([]age.Recipient, 0, len(keys))
+	for _, key := range keys {
+		recipient, err := age.ParseX25519Recipient(key)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный открытый ключ age %q: %w", key, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// EncryptedStorage шифрует все записываемые объекты открытыми ключами
+// получателей и сохраняет их в хранилище Storage. Put сохраняет объект
+// одним файлом age. Append дописывает каждую порцию данных отдельным
+// сообщением age в текстовой (armor) форме, поэтому журналы можно
+// дополнять, не расшифровывая. Get, Exists, Delete и List работают с
+// хранимыми, то есть зашифрованными, объектами.
+type EncryptedStorage struct {
+	Storage
+	recipients []age.Recipient
+}
+
+// NewEncryptedStorage создает шифрующее хранилище поверх storage
+func NewEncryptedStorage(storage Storage, config EncryptionConfig) (*EncryptedStorage, error) {
+	recipients, err := parseRecipients(config.Recipients)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedStorage{Storage: storage, recipients: recipients}, nil
+}
+
+// Put шифрует объект потоком и записывает его в хранилище
+func (s *EncryptedStorage) Put(key string, r io.Reader) error {
+	reader, writer := io.Pipe()
+	go func() {
+		encrypted, err := age.Encrypt(writer, s.recipients...)
+		if err != nil {
+			writer.CloseWithError(fmt.Errorf("ошибка шифрования %s: %w", key, err))
+			return
+		}
+		if _, err := io.Copy(encrypted, r); err != nil {
+			writer.CloseWithError(err)
+			return
+		}
+		writer.CloseWithError(encrypted.Close())
+	}()
+
+	err := s.Storage.Put(key, reader)
+	reader.CloseWithError(io.ErrClosedPipe)
+	return err
+}
+
+// Append шифрует данные отдельным сообщением и дописывает его в объект
+func (s *EncryptedStorage) Append(key string, data []byte) error {
+	var buf bytes.Buffer
+	armored := armor.NewWriter(&buf)
+	encrypted, err := age.Encrypt(armored, s.recipients...)
+	if err != nil {
+		return fmt.Errorf("ошибка шифрования %s: %w", key, err)
+	}
+	if _, err := encrypted.Write(data); err != nil {
+		return fmt.Errorf("ошибка шифрования %s: %w", key, err)
+	}
+	if err := encrypted.Close(); err != nil {
+		return fmt.Errorf("ошибка шифрования %s: %w", key, err)
+	}
+	if err := armored.Close(); err != nil {
+		return fmt.Errorf("ошибка шифрования %s: %w", key, err)
+	}
+	buf.WriteByte('\n')
+	return s.Storage.Append(key, buf.Bytes())
+}
+
+// Decrypt расшифровывает объект, записанный EncryptedStorage: файл age или
+// последовательность сообщений age в текстовой форме, записанных Append.
+// Расшифрованные данные записываются в dst.
+func Decrypt(dst io.Writer, src io.Reader, identities []age.Identity) error {
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)) {
+		plain, err := age.Decrypt(bytes.NewReader(data), identities...)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, plain)
+		return err
+	}
+
+	// Журнал из сообщений расшифровывается по одному сообщению
+	footer := []byte(armor.Footer)
+	for rest := bytes.TrimSpace(data); len(rest) > 0; rest = bytes.TrimSpace(rest) {
+		end := bytes.Index(rest, footer)
+		if end < 0 {
+			return fmt.Errorf("незавершенное сообщение age")
+		}
+		end += len(footer)
+		plain, err := age.Decrypt(armor.NewReader(bytes.NewReader(rest[:end])), identities...)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(dst, plain); err != nil {
+			return err
+		}
+		rest = rest[end:]
+	}
+	return nil
+}
+
+// DecryptFile расшифровывает файл и записывает результат без суффикса .age
+// в директорию outDir (по умолчанию рядом с исходным файлом). Возвращает
+// путь к расшифрованному файлу.
+func DecryptFile(file, outDir string, identities []age.Identity) (string, error) {
+	name := filepath.Base(file)
+	if !strings.HasSuffix(name, encryptedSuffix) {
+		return "", fmt.Errorf("файл %s не зашифрован: ожидается суффикс %s", file, encryptedSuffix)
+	}
+	if outDir == "" {
+		outDir = filepath.Dir(file)
+	}
+	target := filepath.Join(outDir, strings.TrimSuffix(name, encryptedSuffix))
+
+	src, err := os.Open(file)
+	if err != nil {
+		return "", fmt.Errorf("не удалось открыть файл %s: %w", file, err)
+	}
+	defer src.Close()
+
+	var buf bytes.Buffer
+	if err := Decrypt(&buf, src, identities); err != nil {
+		return "", fmt.Errorf("не удалось расшифровать %s: %w", file, err)
+	}
+	data := buf.Bytes()
+	if strings.HasSuffix(target, ".zip") {
+		if data, err = decryptZip(data, identities); err != nil {
+			return "", fmt.Errorf("не удалось расшифровать архив %s: %w", file, err)
+		}
+	}
+
+	if err := os.WriteFile(target, data, 0600); err != nil {
+		return "", fmt.Errorf("не удалось записать файл %s: %w", target, err)
+	}
+	return target, nil
+}
+
+// decryptZip расшифровывает зашифрованные файлы внутри zip-архива и
+// возвращает архив с расшифрованными файлами
+func decryptZip(data []byte, identities []age.Identity) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	for _, f := range archive.File {
+		src, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		name := f.Name
+		encrypted := strings.HasSuffix(name, encryptedSuffix)
+		if encrypted {
+			name = strings.TrimSuffix(name, encryptedSuffix)
+		}
+		dst, err := zipWriter.Create(name)
+		if err == nil {
+			if encrypted {
+				err = Decrypt(dst, src, identities)
+			} else {
+				_, err = io.Copy(dst, src)
+			}
+		}
+		src.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// envPrefix — префикс переменных окружения, переопределяющих конфигурацию
+const envPrefix = "SURVEY_"
+
+// redactedValue заменяет значения секретных полей при выводе конфигурации
+const redactedValue = "******"
+
+// configField описывает поле конфигурации, которое можно задать переменной окружения
+type configField struct {
+	Path   string // Путь в файле конфигурации, например smtp_pass или email.to
+	Env    string // Имя переменной окружения, например SURVEY_SMTP_PASS
+	Secret bool   // Значение не выводится в журнал
+	Value  reflect.Value
+}
+
+// configFields перечисляет скалярные поля конфигурации, включая вложенные
+// структуры. Списки вопросов и служебные поля не переопределяются.
+func configFields(config *Config) []configField {
+	var fields []configField
+	collectConfigFields(reflect.ValueOf(config).Elem(), nil, &fields)
+	return fields
+}
+
+// collectConfigFields рекурсивно обходит поля структуры по их JSON-тегам
+func collectConfigFields(v reflect.Value, path []string, fields *[]configField) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || sf.PkgPath != "" {
+			continue
+		}
+
+		fieldPath := append(append([]string(nil), path...), name)
+		fv := v.Field(i)
+		switch {
+		case fv.Kind() == reflect.Struct:
+			collectConfigFields(fv, fieldPath, fields)
+		case isScalarKind(fv.Kind()) || (fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.String):
+			*fields = append(*fields, configField{
+				Path:   strings.Join(fieldPath, "."),
+				Env:    envPrefix + strings.ToUpper(strings.Join(fieldPath, "_")),
+				Secret: sf.Tag.Get("secret") == "true",
+				Value:  fv,
+			})
+		}
+	}
+}
+
+// isScalarKind проверяет, можно ли задать значение поля одной строкой
+func isScalarKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// applyEnvOverrides переопределяет поля конфигурации переменными окружения.
+// Для каждого поля используется переменная SURVEY_<ПУТЬ> со значением либо
+// SURVEY_<ПУТЬ>_FILE с путем к файлу, из которого читается значение (для
+// секретов, смонтированных в контейнер). Переменные имеют приоритет над
+// файлом конфигурации; задавать обе формы для одного поля нельзя.
+func applyEnvOverrides(config *Config, lookup func(string) (string, bool)) error {
+	for _, field := range configFields(config) {
+		value, hasValue := lookup(field.Env)
+		filePath, hasFile := lookup(field.Env + "_FILE")
+
+		if hasValue && hasFile {
+			return fmt.Errorf("поле %s задано одновременно переменными %s и %s_FILE; "+
+				"приоритет: переменная окружения или файл секрета, затем файл конфигурации — укажите только одну из переменных",
+				field.Path, field.Env, field.Env)
+		}
+		if hasFile {
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				return fmt.Errorf("не удалось прочитать файл %s из переменной %s_FILE для поля %s: %w",
+					filePath, field.Env, field.Path, err)
+			}
+			value, hasValue = strings.TrimRight(string(content), "\r\n"), true
+		}
+		if !hasValue {
+			continue
+		}
+
+		if err := setFieldValue(field.Value, value); err != nil {
+			source := field.Env
+			if hasFile {
+				source += "_FILE"
+			}
+			return fmt.Errorf("переменная %s переопределяет поле %s недопустимым значением: %w", source, field.Path, err)
+		}
+	}
+	return nil
+}
+
+// setFieldValue записывает строковое значение в поле с учетом его типа
+func setFieldValue(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("ожидается true или false")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("ожидается целое число")
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("ожидается число")
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		// Списки задаются значениями через запятую
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("тип %s не поддерживается", v.Type())
+	}
+	return nil
+}
+
+// String выводит настройки конфигурации для журнала. Значения секретных
+// полей скрываются, вопросы опросов не выводятся.
+func (c *Config) String() string {
+	settings := make(map[string]interface{})
+	for _, field := range configFields(c) {
+		if field.Secret && !field.Value.IsZero() {
+			settings[field.Path] = redactedValue
+			continue
+		}
+		settings[field.Path] = field.Value.Interface()
+	}
+	surveys := make([]string, len(c.Surveys))
+	for i, s := range c.Surveys {
+		surveys[i] = s.ID + "@" + s.Version
+	}
+	settings["surveys"] = surveys
+
+	out, _ := json.Marshal(settings)
+	return string(out)
+}
+
+// GoString скрывает секреты и при выводе в формате %#v
+func (c *Config) GoString() string {
+	return c.String()
+}
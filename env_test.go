@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// envLookup возвращает функцию поиска переменных окружения в vars
+func envLookup(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "smtp_pass")
+	if err := os.WriteFile(secret, []byte("из файла\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{SMTPHost: "mail.example.com", SMTPPort: 25}
+	err := applyEnvOverrides(config, envLookup(map[string]string{
+		"SURVEY_SMTP_PORT":                     "587",
+		"SURVEY_SMTP_PASS_FILE":                secret,
+		"SURVEY_EMAIL_TO":                      "team@example.com",
+		"SURVEY_STORAGE_ENCRYPTION_RECIPIENTS": "age1a, age1b,",
+		"SURVEY_STORAGE_S3_SECRET_KEY":         "s3-secret",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.SMTPHost != "mail.example.com" || config.SMTPPort != 587 || config.SMTPPass != "из файла" ||
+		config.Email.To != "team@example.com" || config.Storage.S3.SecretKey != "s3-secret" ||
+		!reflect.DeepEqual(config.Storage.Encryption.Recipients, []string{"age1a", "age1b"}) {
+		t.Errorf("конфигурация после переопределения: %+v", *config)
+	}
+
+	// Секреты не попадают в журнал
+	for _, out := range []string{config.String(), fmt.Sprintf("%v", config), fmt.Sprintf("%#v", config)} {
+		if strings.Contains(out, "из файла") || strings.Contains(out, "s3-secret") {
+			t.Errorf("секрет в выводе конфигурации: %s", out)
+		}
+	}
+}
+
+func TestApplyEnvOverridesErrors(t *testing.T) {
+	for name, vars := range map[string]map[string]string{
+		"значение и файл":    {"SURVEY_SMTP_PASS": "a", "SURVEY_SMTP_PASS_FILE": "/dev/null"},
+		"нет файла":          {"SURVEY_SMTP_PASS_FILE": filepath.Join(t.TempDir(), "missing")},
+		"порт не число":      {"SURVEY_SMTP_PORT": "smtp"},
+		"флаг не логический": {"SURVEY_RANDOMIZE_QUESTIONS": "да"},
+	} {
+		if err := applyEnvOverrides(&Config{}, envLookup(vars)); err == nil {
+			t.Errorf("%s: ошибка не обнаружена", name)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// configExtensions перечисляет поддерживаемые расширения файлов конфигурации
+// и определений опросов
+var configExtensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+// isConfigFile проверяет, что формат файла поддерживается
+func isConfigFile(path string) bool {
+	return contains(configExtensions, strings.ToLower(filepath.Ext(path)))
+}
+
+// configFormat возвращает название формата файла по его расширению
+func configFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "YAML"
+	case ".toml":
+		return "TOML"
+	default:
+		return "JSON"
+	}
+}
+
+// decodeConfigFile читает файл конфигурации или опроса в формате, заданном
+// расширением. YAML и TOML сначала приводятся к JSON, чтобы для всех форматов
+// действовали одни и те же имена полей и правила разбора (например, запись
+// варианта ответа строкой).
+func decodeConfigFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	format := configFormat(path)
+	if format != "JSON" {
+		var generic interface{}
+		if format == "YAML" {
+			err = yaml.Unmarshal(data, &generic)
+		} else {
+			var table map[string]interface{}
+			err = toml.Unmarshal(data, &table)
+			generic = table
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка разбора %s: %w", format, err)
+		}
+
+		data, err = json.Marshal(normalizeGeneric(generic))
+		if err != nil {
+			return fmt.Errorf("ошибка преобразования %s: %w", format, err)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("ошибка декодирования %s: %w", format, err)
+	}
+	return nil
+}
+
+// normalizeGeneric приводит разобранный YAML к структурам, которые можно
+// сериализовать в JSON: ключи отображений всегда становятся строками
+func normalizeGeneric(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, item := range value {
+			value[k] = normalizeGeneric(item)
+		}
+		return value
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			converted[fmt.Sprint(k)] = normalizeGeneric(item)
+		}
+		return converted
+	case []interface{}:
+		for i, item := range value {
+			value[i] = normalizeGeneric(item)
+		}
+		return value
+	case []map[string]interface{}:
+		// Массивы таблиц TOML
+		items := make([]interface{}, len(value))
+		for i, item := range value {
+			items[i] = normalizeGeneric(item)
+		}
+		return items
+	default:
+		return v
+	}
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultLanguage — язык интерфейса и текстов опроса по умолчанию
+const defaultLanguage = "ru"
+
+// languagePattern ограничивает коды языков видом ru, en, pt-BR
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// SurveyTranslation содержит перевод заголовка опроса на другой язык
+type SurveyTranslation struct {
+	Title string `json:"title,omitempty"`
+}
+
+// QuestionTranslation содержит перевод вопроса на другой язык. Подписи
+// вариантов и столбцов задаются по их кодам, строки матрицы — по порядку.
+// Непереведенные тексты показываются на основном языке опроса.
+type QuestionTranslation struct {
+	Text    string            `json:"text,omitempty"`
+	Options map[string]string `json:"options,omitempty"`
+	Rows    []string          `json:"rows,omitempty"`
+	Columns map[string]string `json:"columns,omitempty"`
+	Unit    string            `json:"unit,omitempty"`
+
+	Placeholder string `json:"placeholder,omitempty"`
+	HelpText    string `json:"help_text,omitempty"`
+}
+
+// baseLanguage возвращает язык, на котором написаны тексты опроса
+func (s *Survey) baseLanguage() string {
+	if s.Language != "" {
+		return s.Language
+	}
+	return defaultLanguage
+}
+
+// Languages возвращает языки, на которых доступен опрос: основной язык
+// и языки всех переводов
+func (s *Survey) Languages() []string {
+	seen := map[string]bool{s.baseLanguage(): true}
+	for lang := range s.Translations {
+		seen[lang] = true
+	}
+	for _, q := range s.Questions {
+		for lang := range q.Translations {
+			seen[lang] = true
+		}
+	}
+
+	languages := make([]string, 0, len(seen))
+	for lang := range seen {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// LocalizedTitle возвращает заголовок опроса на языке lang
+func (s *Survey) LocalizedTitle(lang string) string {
+	if t, ok := s.Translations[lang]; ok && t.Title != "" {
+		return t.Title
+	}
+	return s.Title
+}
+
+// localizeQuestions возвращает копии вопросов с текстами на языке lang
+func localizeQuestions(questions []QuestionData, lang string) []QuestionData {
+	localized := make([]QuestionData, len(questions))
+	for i, q := range questions {
+		localized[i] = localizeQuestion(q, lang)
+	}
+	return localized
+}
+
+// localizeQuestion возвращает копию вопроса с текстом, подписями вариантов,
+// строками матрицы, единицей измерения, подсказкой и пояснением на языке lang
+func localizeQuestion(q QuestionData, lang string) QuestionData {
+	t, ok := q.Translations[lang]
+	if !ok {
+		return q
+	}
+
+	if t.Text != "" {
+		q.Text = t.Text
+	}
+	if t.Unit != "" {
+		q.Unit = t.Unit
+	}
+	if t.Placeholder != "" {
+		q.Placeholder = t.Placeholder
+	}
+	if t.HelpText != "" {
+		q.HelpText = t.HelpText
+	}
+	q.Options = localizeOptions(q.Options, t.Options)
+	q.Columns = localizeOptions(q.Columns, t.Columns)
+	if len(t.Rows) > 0 {
+		rows := make([]string, len(q.Rows))
+		for i, row := range q.Rows {
+			rows[i] = row
+			if i < len(t.Rows) && t.Rows[i] != "" {
+				rows[i] = t.Rows[i]
+			}
+		}
+		q.Rows = rows
+	}
+	return q
+}
+
+// localizeOptions возвращает копию вариантов с переведенными подписями
+func localizeOptions(options []Option, labels map[string]string) []Option {
+	if len(labels) == 0 {
+		return options
+	}
+	localized := make([]Option, len(options))
+	for i, o := range options {
+		if label, ok := labels[o.Value]; ok && label != "" {
+			o.Label = label
+		}
+		localized[i] = o
+	}
+	return localized
+}
+
+// translationProblems проверяет переводы опроса: коды языков и ссылки на
+// существующие варианты ответа и строки матрицы
+func translationProblems(survey *Survey) []problem {
+	var problems []problem
+
+	if survey.Language != "" && !languagePattern.MatchString(survey.Language) {
+		problems = append(problems, problem{Path: "language", Message: fmt.Sprintf("недопустимый код языка %s", survey.Language)})
+	}
+	var languages []string
+	for lang := range survey.Translations {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	for _, lang := range languages {
+		if !languagePattern.MatchString(lang) {
+			problems = append(problems, problem{Path: "translations." + lang, Message: fmt.Sprintf("недопустимый код языка %s", lang)})
+		}
+	}
+
+	for i, q := range survey.Questions {
+		for _, lang := range sortedTranslations(q.Translations) {
+			t := q.Translations[lang]
+			add := func(field, format string, args ...interface{}) {
+				problems = append(problems, problem{
+					Path:    questionPath(i, "translations."+lang+field),
+					Message: fmt.Sprintf("вопрос #%d: перевод %s: "+format, append([]interface{}{i + 1, lang}, args...)...),
+				})
+			}
+
+			if !languagePattern.MatchString(lang) {
+				add("", "недопустимый код языка")
+				continue
+			}
+			for _, value := range sortedStrings(t.Options) {
+				if !contains(optionValues(q.Options), value) {
+					add(".options", "неизвестный вариант %s", value)
+				}
+			}
+			for _, value := range sortedStrings(t.Columns) {
+				if !contains(optionValues(q.Columns), value) {
+					add(".columns", "неизвестный столбец %s", value)
+				}
+			}
+			if len(t.Rows) > len(q.Rows) {
+				add(".rows", "строк в переводе больше, чем в вопросе")
+			}
+		}
+	}
+
+	return problems
+}
+
+// sortedTranslations возвращает языки переводов вопроса в алфавитном порядке
+func sortedTranslations(translations map[string]QuestionTranslation) []string {
+	languages := make([]string, 0, len(translations))
+	for lang := range translations {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// sortedStrings возвращает ключи отображения в алфавитном порядке
+func sortedStrings(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// chooseLanguage выбирает язык опроса для запроса: параметр ?lang=,
+// затем заголовок Accept-Language, затем основной язык опроса
+func chooseLanguage(r *http.Request, survey *Survey) (string, bool) {
+	languages := survey.Languages()
+	if lang, ok := matchLanguage(r.URL.Query().Get("lang"), languages); ok {
+		return lang, true
+	}
+	for _, requested := range parseAcceptLanguage(r.Header.Get("Accept-Language")) {
+		if lang, ok := matchLanguage(requested, languages); ok {
+			return lang, false
+		}
+	}
+	return survey.baseLanguage(), false
+}
+
+// matchLanguage находит среди доступных языков запрошенный язык или язык
+// с тем же основным кодом (en-US → en)
+func matchLanguage(requested string, languages []string) (string, bool) {
+	requested = strings.TrimSpace(requested)
+	if requested == "" {
+		return "", false
+	}
+	for _, lang := range languages {
+		if strings.EqualFold(lang, requested) {
+			return lang, true
+		}
+	}
+	primary := strings.ToLower(strings.SplitN(requested, "-", 2)[0])
+	for _, lang := range languages {
+		if strings.ToLower(strings.SplitN(lang, "-", 2)[0]) == primary {
+			return lang, true
+		}
+	}
+	return "", false
+}
+
+// parseAcceptLanguage возвращает языки из заголовка Accept-Language в порядке
+// убывания предпочтения
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	var items []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		lang := strings.TrimSpace(fields[0])
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			items = append(items, weighted{lang, q})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].q > items[j].q })
+
+	languages := make([]string, len(items))
+	for i, item := range items {
+		languages[i] = item.lang
+	}
+	return languages
+}
+
+// Catalog — каталог переводов сообщений интерфейса и сервера:
+// язык → ключ сообщения → текст (формат fmt)
+type Catalog map[string]map[string]string
+
+// Text возвращает сообщение на языке lang. Если перевода нет, используется
+// перевод для основного кода языка, затем язык по умолчанию.
+func (c Catalog) Text(lang, key string, args ...interface{}) string {
+	text, ok := c.lookup(lang, key)
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return text
+	}
+
+	// Вложенные ошибки тоже переводятся на язык сообщения
+	localized := make([]interface{}, len(args))
+	for i, arg := range args {
+		if err, isErr := arg.(error); isErr {
+			localized[i] = c.Error(lang, err)
+		} else {
+			localized[i] = arg
+		}
+	}
+	return fmt.Sprintf(text, localized...)
+}
+
+// lookup ищет сообщение с учетом запасных языков
+func (c Catalog) lookup(lang, key string) (string, bool) {
+	for _, candidate := range []string{lang, strings.SplitN(lang, "-", 2)[0], defaultLanguage} {
+		if text, ok := c[candidate][key]; ok {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// Error возвращает текст ошибки на языке lang. Ошибки, созданные через
+// localizedErrorf, переводятся по каталогу, остальные выводятся как есть.
+func (c Catalog) Error(lang string, err error) string {
+	var le *localizedError
+	if errors.As(err, &le) {
+		return c.Text(lang, le.key, le.args...)
+	}
+	return err.Error()
+}
+
+// localizedError — ошибка, текст которой берется из каталога переводов
+type localizedError struct {
+	key  string
+	args []interface{}
+}
+
+// localizedErrorf создает ошибку с сообщением из каталога по ключу key
+func localizedErrorf(key string, args ...interface{}) error {
+	return &localizedError{key: key, args: args}
+}
+
+// Error возвращает текст ошибки на языке по умолчанию
+func (e *localizedError) Error() string {
+	return builtinCatalog.Text(defaultLanguage, e.key, e.args...)
+}
+
+// LoadCatalog загружает встроенный каталог и дополняет его файлами
+// <язык>.json (.yaml, .toml) из директории dir. Сообщения из файлов
+// переопределяют встроенные и добавляют новые языки.
+func LoadCatalog(dir string) (Catalog, error) {
+	catalog := make(Catalog, len(builtinCatalog))
+	for lang, messages := range builtinCatalog {
+		catalog[lang] = make(map[string]string, len(messages))
+		for key, text := range messages {
+			catalog[lang][key] = text
+		}
+	}
+	if dir == "" {
+		return catalog, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска переводов в %s: %w", dir, err)
+	}
+	for _, path := range paths {
+		if !isConfigFile(path) {
+			continue
+		}
+		lang := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if !languagePattern.MatchString(lang) {
+			return nil, fmt.Errorf("файл переводов %s: имя файла должно быть кодом языка", path)
+		}
+
+		var messages map[string]string
+		if err := decodeConfigFile(path, &messages); err != nil {
+			return nil, fmt.Errorf("файл переводов %s: %w", path, err)
+		}
+		if catalog[lang] == nil {
+			catalog[lang] = make(map[string]string, len(messages))
+		}
+		for key, text := range messages {
+			if _, known := builtinCatalog[defaultLanguage][key]; !known {
+				return nil, fmt.Errorf("файл переводов %s: неизвестный ключ %s", path, key)
+			}
+			catalog[lang][key] = text
+		}
+	}
+	return catalog, nil
+}
+
+// builtinCatalog содержит встроенные переводы интерфейса на русский и английский
+var builtinCatalog = Catalog{
+	"ru": {
+		"survey.title":        "Опрос",
+		"language.label":      "Язык",
+		"record.status":       "Идет запись голоса...",
+		"record.start":        "Начать запись",
+		"record.stop":         "Остановить запись",
+		"record.start_failed": "Не удалось начать запись аудио",
+		"record.stop_failed":  "Не удалось остановить запись аудио",
+		"record.start_error":  "Ошибка при запуске записи",
+		"record.stop_error":   "Ошибка при остановке записи",
+		"answer.custom":       "Свой вариант:",
+		"ranking.hint":        "Перетащите варианты или используйте стрелки, чтобы расположить их в порядке предпочтения.",
+		"ranking.up":          "Выше",
+		"ranking.down":        "Ниже",
+		"upload.size_limit":   "Размер файла — не более %d МБ",
+		"upload.count_limit":  ", не более %d файлов",
+		"submit":              "Отправить ответы",
+		"check.required":      "Пожалуйста, ответьте на все обязательные вопросы",
+		"check.matrix":        "Пожалуйста, заполните все строки обязательных матричных вопросов",
+		"complete.title":      "Опрос завершен",
+		"complete.heading":    "Спасибо за участие!",
+		"complete.text":       "Ваши ответы и аудиозапись успешно отправлены. Благодарим вас за уделенное время.",
+		"complete.again":      "Пройти еще один опрос",
+		"error.internal":      "Внутренняя ошибка сервера",
+		"error.no_session":    "Отсутствует ID сессии",
+		"error.bad_session":   "Недействительная сессия",
+		"error.form":          "Ошибка обработки формы",
+		"error.answers":       "Ошибка в ответах: %v",
+		"error.save_file":     "Не удалось сохранить файл",
+		"error.save_answers":  "Не удалось сохранить ответы",
+		"error.start_record":  "Не удалось начать запись",
+		"error.stop_record":   "Не удалось остановить запись",
+		"answer.row_missing":  "не заполнена строка «%s» вопроса «%s»",
+		"answer.row_single":   "в строке «%s» вопроса «%s» допускается только один ответ",
+		"answer.row_invalid":  "недопустимый ответ «%s» в строке «%s»",
+		"answer.missing":      "не заполнен вопрос «%s»",
+		"answer.question":     "вопрос «%s»: %v",
+		"answer.permutation":  "вопрос «%s»: порядок должен содержать каждый вариант ровно один раз",
+		"answer.invalid":      "недопустимый ответ «%s» на вопрос «%s»",
+		"answer.single":       "на вопрос «%s» допускается только один ответ",
+		"answer.no_file":      "не загружен файл для вопроса «%s»",
+		"answer.too_many":     "вопрос «%s»: можно загрузить не более %d файлов",
+		"answer.file_size":    "файл «%s» превышает допустимый размер %d МБ",
+		"answer.file_type":    "файл «%s» имеет недопустимый тип %s",
+		"answer.not_number":   "«%s» не является числом",
+		"answer.min":          "значение должно быть не меньше %v",
+		"answer.max":          "значение должно быть не больше %v",
+		"answer.step":         "значение должно быть кратно шагу %v",
+		"answer.not_date":     "«%s» не является датой",
+		"answer.not_datetime": "«%s» не является датой и временем",
+		"answer.not_email":    "«%s» не является адресом email",
+		"answer.not_phone":    "«%s» не является номером телефона",
+	},
+	"en": {
+		"survey.title":        "Survey",
+		"language.label":      "Language",
+		"record.status":       "Recording your voice...",
+		"record.start":        "Start recording",
+		"record.stop":         "Stop recording",
+		"record.start_failed": "Could not start audio recording",
+		"record.stop_failed":  "Could not stop audio recording",
+		"record.start_error":  "Error while starting the recording",
+		"record.stop_error":   "Error while stopping the recording",
+		"answer.custom":       "Other:",
+		"ranking.hint":        "Drag the options or use the arrows to put them in order of preference.",
+		"ranking.up":          "Up",
+		"ranking.down":        "Down",
+		"upload.size_limit":   "Maximum file size is %d MB",
+		"upload.count_limit":  ", up to %d files",
+		"submit":              "Submit answers",
+		"check.required":      "Please answer all required questions",
+		"check.matrix":        "Please fill in all rows of the required grid questions",
+		"complete.title":      "Survey completed",
+		"complete.heading":    "Thank you for taking part!",
+		"complete.text":       "Your answers and audio recording have been sent. Thank you for your time.",
+		"complete.again":      "Take another survey",
+		"error.internal":      "Internal server error",
+		"error.no_session":    "Missing session ID",
+		"error.bad_session":   "Invalid session",
+		"error.form":          "Could not process the form",
+		"error.answers":       "Invalid answers: %v",
+		"error.save_file":     "Could not save the file",
+		"error.save_answers":  "Could not save the answers",
+		"error.start_record":  "Could not start recording",
+		"error.stop_record":   "Could not stop recording",
+		"answer.row_missing":  "row “%s” of question “%s” is not answered",
+		"answer.row_single":   "only one answer is allowed in row “%s” of question “%s”",
+		"answer.row_invalid":  "invalid answer “%s” in row “%s”",
+		"answer.missing":      "question “%s” is not answered",
+		"answer.question":     "question “%s”: %v",
+		"answer.permutation":  "question “%s”: the order must contain every option exactly once",
+		"answer.invalid":      "invalid answer “%s” to question “%s”",
+		"answer.single":       "only one answer is allowed for question “%s”",
+		"answer.no_file":      "no file uploaded for question “%s”",
+		"answer.too_many":     "question “%s”: at most %d files can be uploaded",
+		"answer.file_size":    "file “%s” exceeds the size limit of %d MB",
+		"answer.file_type":    "file “%s” has a type that is not allowed: %s",
+		"answer.not_number":   "“%s” is not a number",
+		"answer.min":          "the value must be at least %v",
+		"answer.max":          "the value must be at most %v",
+		"answer.step":         "the value must be a multiple of %v",
+		"answer.not_date":     "“%s” is not a date",
+		"answer.not_datetime": "“%s” is not a date and time",
+		"answer.not_email":    "“%s” is not an email address",
+		"answer.not_phone":    "“%s” is not a phone number",
+	},
+}
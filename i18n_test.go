@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestChooseLanguage(t *testing.T) {
+	survey := &Survey{Questions: []QuestionData{{
+		ID: "q", Translations: map[string]QuestionTranslation{"en": {Text: "Q"}, "pt-BR": {Text: "P"}},
+	}}}
+	for _, tc := range []struct {
+		url, accept, want string
+		explicit          bool
+	}{
+		{"/survey?lang=en", "pt-BR", "en", true},
+		{"/survey?lang=xx", "pt-BR", "pt-BR", false},
+		{"/survey", "de;q=0.9, en-US;q=0.8, pt;q=0.5", "en", false},
+		{"/survey", "pt;q=0.9, en;q=0", "pt-BR", false},
+		{"/survey", "de", defaultLanguage, false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, tc.url, nil)
+		r.Header.Set("Accept-Language", tc.accept)
+		if got, explicit := chooseLanguage(r, survey); got != tc.want || explicit != tc.explicit {
+			t.Errorf("%s, %q: язык %s (%v), ожидался %s (%v)", tc.url, tc.accept, got, explicit, tc.want, tc.explicit)
+		}
+	}
+}
+
+func TestLocalizeQuestion(t *testing.T) {
+	q := testQuestions(t, `[{"id": "m", "text": "Оцените", "type": "matrix",
+		"rows": ["Цена", "Качество"], "columns": [{"value": "1", "label": "Плохо"}, {"value": "2", "label": "Хорошо"}],
+		"translations": {"en": {"text": "Rate", "rows": ["Price"], "columns": {"2": "Good"}}}}]`)[0]
+
+	en := localizeQuestion(q, "en-GB")
+	if en.Text != "Rate" || !reflect.DeepEqual(en.Rows, []string{"Price", "Качество"}) ||
+		en.Columns[0].Label != "Плохо" || en.Columns[1].Label != "Good" || en.Columns[1].Value != "2" {
+		t.Errorf("перевод на en: %+v", en)
+	}
+	if q.Text != "Оцените" || q.Columns[1].Label != "Хорошо" {
+		t.Errorf("перевод изменил исходный вопрос: %+v", q)
+	}
+	if de := localizeQuestion(q, "de"); de.Text != "Оцените" {
+		t.Errorf("без перевода показан текст «%s»", de.Text)
+	}
+}
+
+func TestCatalogText(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "de.json"), []byte(`{"answer.missing": "Frage „%s“ ist nicht beantwortet"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := LoadCatalog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = localizedErrorf("answer.missing", "Имя")
+	for lang, want := range map[string]string{
+		"de":    "Frage „Имя“ ist nicht beantwortet",
+		"en-US": "question “Имя” is not answered",
+		"fr":    "не заполнен вопрос «Имя»",
+	} {
+		if got := catalog.Error(lang, err); got != want {
+			t.Errorf("%s: %q, ожидалось %q", lang, got, want)
+		}
+	}
+	if got := catalog.Text("de", "error.no_session"); got != builtinCatalog.Text(defaultLanguage, "error.no_session") {
+		t.Errorf("сообщение без перевода на de: %q", got)
+	}
+}
@@ -0,0 +1,742 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Diagnostic — замечание команды validate с позицией в файле. Для TOML
+// строка и столбец неизвестны, и место указывается только путем к полю.
+type Diagnostic struct {
+	File    string
+	Line    int
+	Column  int
+	Path    string
+	Message string
+	// Warning отмечает настройки, которые не влияют на опрос
+	Warning bool
+}
+
+// String форматирует замечание в виде file:line:col: сообщение
+func (d Diagnostic) String() string {
+	var b strings.Builder
+	b.WriteString(d.File)
+	if d.Line > 0 {
+		fmt.Fprintf(&b, ":%d:%d", d.Line, d.Column)
+	}
+	b.WriteString(": ")
+	if d.Line == 0 && d.Path != "" {
+		b.WriteString(d.Path + ": ")
+	}
+	if d.Warning {
+		b.WriteString("предупреждение: ")
+	}
+	b.WriteString(d.Message)
+	return b.String()
+}
+
+// lintKind — вид узла разобранного файла
+type lintKind int
+
+const (
+	lintScalar lintKind = iota
+	lintObject
+	lintArray
+)
+
+// lintNode — узел разобранного файла конфигурации с позицией в исходном тексте
+type lintNode struct {
+	Kind   lintKind
+	Line   int
+	Column int
+	Fields []lintField // Поля объекта в порядке записи
+	Items  []*lintNode // Элементы списка
+	Value  interface{} // Значение: string, float64, bool или nil
+	// invalid отмечает значение неверного типа, которое пропускается при
+	// декодировании, чтобы проверить остальную часть файла
+	invalid bool
+}
+
+// lintField — поле объекта с позицией его имени
+type lintField struct {
+	Name   string
+	Line   int
+	Column int
+	Value  *lintNode
+}
+
+// field возвращает значение поля объекта по имени
+func (n *lintNode) field(name string) (*lintNode, bool) {
+	if n == nil || n.Kind != lintObject {
+		return nil, false
+	}
+	for _, f := range n.Fields {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// lintPathPattern разбирает путь к полю вида questions[2].options[1]
+var lintPathPattern = regexp.MustCompile(`([^.\[\]]+)|\[(\d+)\]`)
+
+// locate находит позицию поля по пути. Если поле отсутствует в файле,
+// возвращается позиция ближайшего существующего родителя.
+func (n *lintNode) locate(path string) (int, int) {
+	_, line, col := n.lookup(path)
+	return line, col
+}
+
+// lookup находит узел по пути и позицию поля; если поле отсутствует,
+// возвращает ближайшего существующего родителя
+func (n *lintNode) lookup(path string) (*lintNode, int, int) {
+	line, col := n.Line, n.Column
+	node := n
+	for _, m := range lintPathPattern.FindAllStringSubmatch(path, -1) {
+		if node == nil {
+			break
+		}
+		if m[2] != "" {
+			i, _ := strconv.Atoi(m[2])
+			if node.Kind != lintArray || i >= len(node.Items) {
+				break
+			}
+			node = node.Items[i]
+			line, col = node.Line, node.Column
+			continue
+		}
+		found := false
+		for _, f := range node.Fields {
+			if f.Name == m[1] {
+				node, line, col, found = f.Value, f.Line, f.Column, true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return node, line, col
+}
+
+// linter собирает замечания по файлам конфигурации
+type linter struct {
+	diagnostics []Diagnostic
+}
+
+// report добавляет замечание к полю path файла, разобранного в root
+func (l *linter) report(file string, root *lintNode, path string, warning bool, format string, args ...interface{}) {
+	d := Diagnostic{File: file, Path: path, Message: fmt.Sprintf(format, args...), Warning: warning}
+	if root != nil {
+		d.Line, d.Column = root.locate(path)
+	}
+	l.diagnostics = append(l.diagnostics, d)
+}
+
+// LintConfig проверяет файл конфигурации и все определения опросов и
+// возвращает все найденные проблемы: синтаксические ошибки, неизвестные
+// поля и неверные типы значений, ошибки в опросах (повторяющиеся ID вопросов
+// и варианты, неверные подстановки и т.д.), а также настройки, которые не
+// действуют для типа вопроса.
+func LintConfig(path string) []Diagnostic {
+	l := &linter{}
+
+	var config Config
+	root, ok := l.lintFile(path, reflect.TypeOf(config), &config)
+	if ok {
+		if err := applyEnvOverrides(&config, os.LookupEnv); err != nil {
+			l.report(path, nil, "", false, "%v", err)
+		}
+		l.reportProblems(path, root, settingsProblems(&config))
+
+		if len(config.Questions) > 0 {
+			l.lintSurvey(path, root, config.mainSurvey())
+		} else {
+			for _, name := range []string{"randomize_questions", "version"} {
+				if _, set := root.field(name); set {
+					l.report(path, root, name, true, "настройка %s действует только вместе со списком questions", name)
+				}
+			}
+		}
+	}
+
+	surveys := 0
+	if ok && len(config.Questions) > 0 {
+		surveys++
+	}
+	if ok && config.SurveysDir != "" {
+		surveys += l.lintSurveysDir(path, root, &config)
+	}
+	if ok && surveys == 0 {
+		l.report(path, root, "", false, "не задано ни одного опроса: список вопросов пуст и директория опросов не указана")
+	}
+
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		a, b := l.diagnostics[i], l.diagnostics[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return l.diagnostics
+}
+
+// lintSurveysDir проверяет файлы опросов и возвращает количество опросов
+func (l *linter) lintSurveysDir(configPath string, configRoot *lintNode, config *Config) int {
+	paths, err := surveyFiles(config.surveysDir(configPath))
+	if err != nil {
+		l.report(configPath, configRoot, "surveys_dir", false, "%v", err)
+		return 0
+	}
+
+	// Первое определение каждого опроса: файл и его разобранное содержимое
+	type definition struct {
+		file string
+		root *lintNode
+	}
+	defined := make(map[string]definition)
+	if len(config.Questions) > 0 {
+		defined[DefaultSurveyID] = definition{configPath, configRoot}
+	}
+
+	for _, path := range paths {
+		var survey Survey
+		root, ok := l.lintFile(path, reflect.TypeOf(survey), &survey)
+		if !ok {
+			continue
+		}
+		prepareSurveyFile(&survey, path, config.Email)
+
+		if first, exists := defined[survey.ID]; exists {
+			line, _ := first.root.locate("")
+			l.report(path, root, "id", false, "опрос %s уже определен в %s:%d", survey.ID, first.file, line)
+		} else {
+			defined[survey.ID] = definition{path, root}
+		}
+		l.lintSurvey(path, root, &survey)
+	}
+	return len(paths)
+}
+
+// lintFile разбирает файл, проверяет поля по типу t и декодирует его в v.
+// Возвращает дерево файла и признак того, что файл удалось декодировать.
+func (l *linter) lintFile(path string, t reflect.Type, v interface{}) (*lintNode, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		l.report(path, nil, "", false, "невозможно открыть файл: %v", err)
+		return nil, false
+	}
+
+	root, line, col, err := parseLintNodes(configFormat(path), data)
+	if err != nil {
+		l.diagnostics = append(l.diagnostics, Diagnostic{File: path, Line: line, Column: col, Message: err.Error()})
+		return nil, false
+	}
+
+	l.checkNode(path, root, root, t, "")
+
+	// Декодируем дерево без значений неверного типа, как decodeConfigFile
+	// декодирует YAML и TOML, чтобы остальные проверки выполнялись и при
+	// ошибках в отдельных полях
+	data, err = json.Marshal(root.generic())
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		l.report(path, nil, "", false, "ошибка декодирования %s: %v", configFormat(path), err)
+		return root, false
+	}
+	return root, true
+}
+
+// generic возвращает значение узла в виде, пригодном для сериализации в JSON,
+// пропуская значения неверного типа
+func (n *lintNode) generic() interface{} {
+	switch n.Kind {
+	case lintObject:
+		fields := make(map[string]interface{}, len(n.Fields))
+		for _, f := range n.Fields {
+			if !f.Value.invalid {
+				fields[f.Name] = f.Value.generic()
+			}
+		}
+		return fields
+	case lintArray:
+		items := make([]interface{}, 0, len(n.Items))
+		for _, item := range n.Items {
+			if !item.invalid {
+				items = append(items, item.generic())
+			}
+		}
+		return items
+	default:
+		return n.Value
+	}
+}
+
+// reportProblems добавляет ошибки проверки конфигурации. Ошибки в полях,
+// значение которых уже отмечено как неверное по типу, не повторяются.
+func (l *linter) reportProblems(file string, root *lintNode, problems []problem) {
+	for _, p := range problems {
+		if node, _, _ := root.lookup(p.Path); node != nil && node.invalid {
+			continue
+		}
+		l.report(file, root, p.Path, false, "%s", p.Message)
+	}
+}
+
+// lintSurvey проверяет определение опроса и неиспользуемые настройки вопросов
+func (l *linter) lintSurvey(file string, root *lintNode, survey *Survey) {
+	l.reportProblems(file, root, surveyProblems(survey))
+
+	questions, _ := root.field("questions")
+	for i, q := range survey.Questions {
+		if questions == nil || i >= len(questions.Items) {
+			break
+		}
+		node := questions.Items[i]
+		for _, f := range node.Fields {
+			types, limited := questionSettings[f.Name]
+			if limited && !containsType(types, q.Type) {
+				l.report(file, root, questionPath(i, f.Name), true,
+					"вопрос #%d: настройка %s не действует для вопросов типа %s", i+1, f.Name, q.Type)
+			}
+		}
+
+		if !q.RandomizeOptions {
+			for j, o := range q.Options {
+				if o.Pin {
+					l.report(file, root, questionPath(i, fmt.Sprintf("options[%d].pin", j)), true,
+						"вопрос #%d: pin действует только вместе с randomize_options", i+1)
+				}
+			}
+		}
+	}
+}
+
+// questionSettings перечисляет настройки вопроса, которые действуют только
+// для некоторых типов
+var questionSettings = map[string][]QuestionType{
+	"options":           {TypeSingleChoice, TypeMultiChoice, TypeMixed, TypeRanking},
+	"allow_custom":      {TypeMixed},
+	"randomize_options": {TypeSingleChoice, TypeMultiChoice, TypeMixed, TypeRanking},
+	"rows":              {TypeMatrix},
+	"columns":           {TypeMatrix},
+	"multi_select":      {TypeMatrix},
+	"min":               {TypeNumber},
+	"max":               {TypeNumber},
+	"step":              {TypeNumber},
+	"unit":              {TypeNumber},
+	"placeholder":       {TypeText, TypeMixed, TypeNumber, TypeEmail, TypePhone},
+	"allowed_types":     {TypeFileUpload},
+	"max_file_size":     {TypeFileUpload},
+	"max_files":         {TypeFileUpload},
+}
+
+// containsType проверяет, есть ли тип вопроса в списке
+func containsType(types []QuestionType, t QuestionType) bool {
+	for _, item := range types {
+		if item == t {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNode сверяет узел файла с типом поля конфигурации: сообщает о
+// неизвестных и повторяющихся полях и значениях неверного типа
+func (l *linter) checkNode(file string, root, node *lintNode, t reflect.Type, path string) {
+	if node == nil || (node.Kind == lintScalar && node.Value == nil) {
+		return
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// Вариант ответа можно записать строкой или числом
+	if t == reflect.TypeOf(Option{}) && node.Kind == lintScalar {
+		switch node.Value.(type) {
+		case string, float64:
+			return
+		}
+	}
+
+	// Значение по умолчанию — строка, число или их список
+	if t == reflect.TypeOf(DefaultValue{}) {
+		items := []*lintNode{node}
+		if node.Kind == lintArray {
+			items = node.Items
+		}
+		for i, item := range items {
+			itemPath := path
+			if node.Kind == lintArray {
+				itemPath = fmt.Sprintf("%s[%d]", path, i)
+			}
+			switch item.Value.(type) {
+			case string, float64:
+			default:
+				l.invalid(file, root, item, itemPath, "ожидается строка или число")
+			}
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != lintObject {
+			l.invalid(file, root, node, path, "ожидается объект")
+			return
+		}
+		seen := make(map[string]bool)
+		for _, f := range node.Fields {
+			fieldPath := joinLintPath(path, f.Name)
+			if seen[f.Name] {
+				l.report(file, root, fieldPath, false, "поле %s указано повторно", f.Name)
+			}
+			seen[f.Name] = true
+
+			sf, known := schemaField(t, f.Name)
+			if !known {
+				message := fmt.Sprintf("неизвестное поле %s", f.Name)
+				if suggestion := closestName(f.Name, schemaFields(t)); suggestion != "" {
+					message += fmt.Sprintf(", возможно, имелось в виду %s", suggestion)
+				}
+				l.report(file, root, fieldPath, false, "%s", message)
+				continue
+			}
+			l.checkNode(file, root, f.Value, sf.Type, fieldPath)
+		}
+	case reflect.Map:
+		if node.Kind != lintObject {
+			l.invalid(file, root, node, path, "ожидается объект")
+			return
+		}
+		for _, f := range node.Fields {
+			l.checkNode(file, root, f.Value, t.Elem(), joinLintPath(path, f.Name))
+		}
+	case reflect.Slice:
+		if node.Kind != lintArray {
+			l.invalid(file, root, node, path, "ожидается список")
+			return
+		}
+		for i, item := range node.Items {
+			l.checkNode(file, root, item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.String:
+		if _, ok := node.Value.(string); !ok || node.Kind != lintScalar {
+			l.invalid(file, root, node, path, "ожидается строка")
+		}
+	case reflect.Bool:
+		if _, ok := node.Value.(bool); !ok || node.Kind != lintScalar {
+			l.invalid(file, root, node, path, "ожидается true или false")
+		}
+	case reflect.Int, reflect.Int64:
+		if f, ok := node.Value.(float64); !ok || node.Kind != lintScalar || f != float64(int64(f)) {
+			l.invalid(file, root, node, path, "ожидается целое число")
+		}
+	case reflect.Float64:
+		if _, ok := node.Value.(float64); !ok || node.Kind != lintScalar {
+			l.invalid(file, root, node, path, "ожидается число")
+		}
+	}
+}
+
+// invalid сообщает о значении неверного типа и исключает его из декодирования
+func (l *linter) invalid(file string, root, node *lintNode, path, message string) {
+	node.invalid = true
+	l.report(file, root, path, false, "%s", message)
+}
+
+// joinLintPath добавляет имя поля к пути
+func joinLintPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// closestName подбирает известное имя поля, отличающееся от name не более
+// чем на два символа, чтобы подсказать исправление опечатки
+func closestName(name string, names []string) string {
+	best, bestDistance := "", 3
+	for _, candidate := range names {
+		if d := editDistance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance вычисляет расстояние Левенштейна между строками
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+// minInt возвращает наименьшее из чисел
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// parseLintNodes разбирает файл в дерево узлов с позициями. При синтаксической
+// ошибке возвращает ее позицию, если формат ее сообщает.
+func parseLintNodes(format string, data []byte) (*lintNode, int, int, error) {
+	switch format {
+	case "YAML":
+		return parseYAMLNodes(data)
+	case "TOML":
+		return parseTOMLNodes(data)
+	default:
+		return parseJSONNodes(data)
+	}
+}
+
+// jsonNodeParser строит дерево узлов JSON по потоку токенов, вычисляя
+// позиции по смещению токенов в исходном тексте
+type jsonNodeParser struct {
+	data    []byte
+	decoder *json.Decoder
+}
+
+// parseJSONNodes разбирает JSON в дерево узлов
+func parseJSONNodes(data []byte) (*lintNode, int, int, error) {
+	p := &jsonNodeParser{data: data, decoder: json.NewDecoder(bytes.NewReader(data))}
+	p.decoder.UseNumber()
+
+	tok, offset, err := p.next()
+	if err == nil {
+		var root *lintNode
+		root, err = p.value(tok, offset)
+		if err == nil {
+			if _, _, err = p.next(); err == io.EOF {
+				return root, 0, 0, nil
+			} else if err == nil {
+				err = fmt.Errorf("лишние данные после конца документа")
+			}
+		}
+	}
+
+	offset = len(data)
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		offset = int(syntaxErr.Offset)
+	}
+	line, col := textPosition(data, offset)
+	return nil, line, col, fmt.Errorf("ошибка синтаксиса JSON: %v", err)
+}
+
+// next читает следующий токен и возвращает смещение его начала
+func (p *jsonNodeParser) next() (json.Token, int, error) {
+	offset := int(p.decoder.InputOffset())
+	tok, err := p.decoder.Token()
+	for offset < len(p.data) && strings.IndexByte(" \t\r\n,:", p.data[offset]) >= 0 {
+		offset++
+	}
+	return tok, offset, err
+}
+
+// value строит узел для значения, начинающегося с токена tok
+func (p *jsonNodeParser) value(tok json.Token, offset int) (*lintNode, error) {
+	node := &lintNode{}
+	node.Line, node.Column = textPosition(p.data, offset)
+
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			node.Kind = lintObject
+			for p.decoder.More() {
+				key, keyOffset, err := p.next()
+				if err != nil {
+					return nil, err
+				}
+				valueTok, valueOffset, err := p.next()
+				if err != nil {
+					return nil, err
+				}
+				value, err := p.value(valueTok, valueOffset)
+				if err != nil {
+					return nil, err
+				}
+				line, col := textPosition(p.data, keyOffset)
+				node.Fields = append(node.Fields, lintField{Name: key.(string), Line: line, Column: col, Value: value})
+			}
+		} else {
+			node.Kind = lintArray
+			for p.decoder.More() {
+				itemTok, itemOffset, err := p.next()
+				if err != nil {
+					return nil, err
+				}
+				item, err := p.value(itemTok, itemOffset)
+				if err != nil {
+					return nil, err
+				}
+				node.Items = append(node.Items, item)
+			}
+		}
+		// Закрывающая скобка
+		if _, _, err := p.next(); err != nil {
+			return nil, err
+		}
+	case json.Number:
+		node.Value, _ = t.Float64()
+	default:
+		node.Value = t
+	}
+	return node, nil
+}
+
+// textPosition переводит смещение в байтах в номер строки и столбца (с 1)
+func textPosition(data []byte, offset int) (int, int) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	lineStart := bytes.LastIndexByte(data[:offset], '\n') + 1
+	return line, 1 + len([]rune(string(data[lineStart:offset])))
+}
+
+// yamlLinePattern извлекает номер строки из ошибок разбора YAML
+var yamlLinePattern = regexp.MustCompile(`line (\d+)`)
+
+// parseYAMLNodes разбирает YAML в дерево узлов, используя позиции yaml.Node
+func parseYAMLNodes(data []byte) (*lintNode, int, int, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		line := 0
+		if m := yamlLinePattern.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+		}
+		return nil, line, 1, fmt.Errorf("ошибка синтаксиса YAML: %v", err)
+	}
+	if len(document.Content) == 0 {
+		return &lintNode{Kind: lintObject, Line: 1, Column: 1}, 0, 0, nil
+	}
+	return yamlNode(document.Content[0]), 0, 0, nil
+}
+
+// yamlNode преобразует узел YAML
+func yamlNode(n *yaml.Node) *lintNode {
+	if n.Kind == yaml.AliasNode && n.Alias != nil {
+		return yamlNode(n.Alias)
+	}
+
+	node := &lintNode{Line: n.Line, Column: n.Column}
+	switch n.Kind {
+	case yaml.MappingNode:
+		node.Kind = lintObject
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i]
+			node.Fields = append(node.Fields, lintField{
+				Name:   key.Value,
+				Line:   key.Line,
+				Column: key.Column,
+				Value:  yamlNode(n.Content[i+1]),
+			})
+		}
+	case yaml.SequenceNode:
+		node.Kind = lintArray
+		for _, item := range n.Content {
+			node.Items = append(node.Items, yamlNode(item))
+		}
+	default:
+		var value interface{}
+		_ = n.Decode(&value)
+		node.Value = scalarValue(value)
+	}
+	return node
+}
+
+// parseTOMLNodes разбирает TOML в дерево узлов. Библиотека TOML не сообщает
+// позиции ключей, поэтому они известны только для синтаксических ошибок.
+func parseTOMLNodes(data []byte) (*lintNode, int, int, error) {
+	var table map[string]interface{}
+	if _, err := toml.Decode(string(data), &table); err != nil {
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, parseErr.Position.Line, parseErr.Position.Col, fmt.Errorf("ошибка синтаксиса TOML: %s", parseErr.Message)
+		}
+		return nil, 0, 0, fmt.Errorf("ошибка синтаксиса TOML: %v", err)
+	}
+	return genericNode(normalizeGeneric(table)), 0, 0, nil
+}
+
+// genericNode строит узлы без позиций из разобранных данных
+func genericNode(v interface{}) *lintNode {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		node := &lintNode{Kind: lintObject}
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			node.Fields = append(node.Fields, lintField{Name: name, Value: genericNode(value[name])})
+		}
+		return node
+	case []interface{}:
+		node := &lintNode{Kind: lintArray}
+		for _, item := range value {
+			node.Items = append(node.Items, genericNode(item))
+		}
+		return node
+	default:
+		return &lintNode{Kind: lintScalar, Value: scalarValue(v)}
+	}
+}
+
+// scalarValue приводит числа к float64, как при разборе JSON, а прочие
+// значения (например, даты TOML) — к строке
+func scalarValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case nil, string, bool, float64:
+		return value
+	case int:
+		return float64(value)
+	case int64:
+		return float64(value)
+	case uint64:
+		return float64(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeLintConfig записывает конфигурацию во временный файл и возвращает путь
+func writeLintConfig(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLintConfigReportsPositions(t *testing.T) {
+	path := writeLintConfig(t, `{
+  "smtp_host": "127.0.0.1", "smtp_port": 1,
+  "email": {"to": "a@example.com", "from": "a@example.com"},
+  "questions": [
+    {"id": "q1", "text": "Один", "type": "text"},
+    {"id": "q1", "text": "Два", "type": "text", "requried": true},
+    {"id": "q3", "text": "Три", "type": "single_choice", "options": ["a", "a"]},
+    {"id": "q4", "text": "Четыре", "type": "single_choice", "options": ["a", {"value": "b", "pin": true}]}
+  ]
+}`)
+	var got []string
+	for _, d := range LintConfig(path) {
+		got = append(got, strings.TrimPrefix(d.String(), path))
+	}
+	for _, want := range []string{
+		":6:6: вопрос #2: повторяющийся ID q1",
+		":6:49: неизвестное поле requried",
+		":7:75: вопрос #3: вариант «a» повторяется",
+		":8:93: предупреждение: вопрос #4: pin",
+	} {
+		found := false
+		for _, line := range got {
+			found = found || strings.HasPrefix(line, want)
+		}
+		if !found {
+			t.Errorf("нет замечания %q среди:\n%s", want, strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestValidateFailsOnWarningsOnlyWhenStrict(t *testing.T) {
+	path := writeLintConfig(t, `{
+  "smtp_host": "127.0.0.1", "smtp_port": 1,
+  "email": {"to": "a@example.com", "from": "a@example.com"},
+  "questions": [{"id": "q1", "text": "Один", "type": "single_choice", "unit": "кг", "options": ["a"]}]
+}`)
+	diagnostics := LintConfig(path)
+	if len(diagnostics) != 1 || !diagnostics[0].Warning {
+		t.Fatalf("ожидалось одно предупреждение: %v", diagnostics)
+	}
+	if err := runValidate([]string{path}, ""); err != nil {
+		t.Errorf("предупреждение завершило проверку ошибкой: %v", err)
+	}
+	if err := runValidate([]string{"-strict", path}, ""); err == nil {
+		t.Error("с -strict предупреждение не считается ошибкой")
+	}
+	if err := runValidate([]string{writeLintConfig(t, `{"smtp_port": "x"}`)}, ""); err == nil {
+		t.Error("ошибки конфигурации не обнаружены")
+	}
+}
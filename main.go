@@ -8,38 +8,83 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 func main() {
 	// Настройка параметров командной строки
 	configPath := flag.String("config", "config.json", "Путь к файлу конфигурации")
 	port := flag.Int("port", 8080, "Порт для веб-сервера")
+	watchInterval := flag.Duration("watch", 5*time.Second, "Интервал проверки изменений конфигурации (0 — не отслеживать)")
 	flag.Parse()
 
+	// Служебные команды выполняются без запуска сервера
+	if handled, err := runCommand(flag.Args(), *configPath); handled {
+		if err != nil {
+			log.Fatalf("Ошибка: %v", err)
+		}
+		return
+	}
+
 	// Загрузка конфигурации
 	config, err := LoadConfig(*configPath)
 	if err != nil {
 		log.Fatalf("Ошибка загрузки конфигурации: %v", err)
 	}
+	log.Printf("Конфигурация загружена из %s: %v", *configPath, config)
+
+	// Подключение хранилища результатов
+	storage, err := NewStorage(config.Storage)
+	if err != nil {
+		log.Fatalf("Ошибка подключения хранилища: %v", err)
+	}
 
 	// Инициализация хранилища ответов
-	responseHandler := NewResponseHandler()
+	responseHandler := NewResponseHandler(storage, config.Storage.Prefixes, config.RespondentKey)
 
 	// Инициализация аудио рекордера
-	audioRecorder := NewAudioRecorder()
+	audioRecorder := NewAudioRecorder(storage)
 
 	// Инициализация обработчика сессий
 	sessionManager := NewSessionManager(config, responseHandler, audioRecorder)
 
+	// Перезагрузка конфигурации по SIGHUP и при изменении файлов
+	reloader := NewConfigReloader(*configPath, sessionManager)
+	stopWatch := make(chan struct{})
+	if *watchInterval > 0 {
+		go reloader.Watch(*watchInterval, stopWatch)
+	}
+
+	// Повтор неудачных отправок и удаление файлов с истекшим сроком хранения
+	stopRetention := make(chan struct{})
+	go sessionManager.RunRetention(stopRetention)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Println("Получен сигнал SIGHUP, перезагрузка конфигурации...")
+			if err := reloader.Reload(); err != nil {
+				log.Printf("Ошибка перезагрузки конфигурации: %v", err)
+			}
+		}
+	}()
+
 	// Настройка HTTP маршрутов
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/survey", http.StatusFound)
 	})
 	http.HandleFunc("/survey", sessionManager.HandleSurveyPage)
+	http.HandleFunc("/s/", sessionManager.HandleSurveyByID)
 	http.HandleFunc("/submit", sessionManager.HandleSubmit)
 	http.HandleFunc("/start-recording", sessionManager.HandleStartRecording)
 	http.HandleFunc("/stop-recording", sessionManager.HandleStopRecording)
 	http.HandleFunc("/complete", sessionManager.HandleComplete)
+	http.HandleFunc("/admin/dataset", sessionManager.HandleDataset)
+	http.HandleFunc("/admin/respondent", sessionManager.HandleRespondent)
+	http.HandleFunc("/admin/respondent/", sessionManager.HandleRespondent)
+	http.HandleFunc("/admin/deliveries", sessionManager.HandleDeliveries)
+	http.HandleFunc("/admin/deliveries/", sessionManager.HandleDeliveries)
 
 	// Обработка статических файлов
 	fs := http.FileServer(http.Dir("static"))
@@ -66,6 +111,8 @@ func main() {
 	log.Println("Завершение работы сервера...")
 
 	// Очистка ресурсов перед завершением
+	close(stopWatch)
+	close(stopRetention)
 	sessionManager.Cleanup()
 	log.Println("Сервер остановлен")
 }
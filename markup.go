@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// Разметка пояснений к вопросам: поддерживается небольшое безопасное
+// подмножество markdown — **жирный**, *курсив*, `код`, [ссылка](https://...),
+// списки со строками «- » и абзацы, разделенные пустой строкой. Весь
+// остальной текст экранируется, HTML из конфигурации не выводится.
+var (
+	markupCode   = regexp.MustCompile("`([^`]+)`")
+	markupLink   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	markupBold   = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	markupItalic = regexp.MustCompile(`\*([^*]+)\*`)
+	markupItem   = regexp.MustCompile(`^[-*]\s+`)
+)
+
+// renderHelpText преобразует текст пояснения в HTML
+func renderHelpText(text string) template.HTML {
+	var b strings.Builder
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		lines := strings.Split(strings.TrimSpace(paragraph), "\n")
+		if len(lines) == 1 && lines[0] == "" {
+			continue
+		}
+
+		inList := false
+		var textLines []string
+		flush := func() {
+			if len(textLines) > 0 {
+				b.WriteString("<p>" + strings.Join(textLines, "<br>") + "</p>")
+				textLines = nil
+			}
+		}
+		for _, line := range lines {
+			line = strings.TrimSpace(line)
+			if markupItem.MatchString(line) {
+				flush()
+				if !inList {
+					b.WriteString("<ul>")
+					inList = true
+				}
+				b.WriteString("<li>" + renderInline(markupItem.ReplaceAllString(line, "")) + "</li>")
+				continue
+			}
+			if inList {
+				b.WriteString("</ul>")
+				inList = false
+			}
+			textLines = append(textLines, renderInline(line))
+		}
+		flush()
+		if inList {
+			b.WriteString("</ul>")
+		}
+	}
+	return template.HTML(b.String())
+}
+
+// renderInline экранирует строку и применяет строчную разметку
+func renderInline(text string) string {
+	text = template.HTMLEscapeString(text)
+
+	// Содержимое `кода` не размечается: заменяем его метками до конца обработки
+	var codes []string
+	text = markupCode.ReplaceAllStringFunc(text, func(match string) string {
+		codes = append(codes, "<code>"+markupCode.FindStringSubmatch(match)[1]+"</code>")
+		return fmt.Sprintf("\x00%d\x00", len(codes)-1)
+	})
+
+	text = markupLink.ReplaceAllStringFunc(text, func(match string) string {
+		m := markupLink.FindStringSubmatch(match)
+		if !safeLink(m[2]) {
+			return m[1]
+		}
+		return fmt.Sprintf(`<a href="%s" target="_blank" rel="noopener noreferrer">%s</a>`, m[2], m[1])
+	})
+	text = markupBold.ReplaceAllString(text, "<strong>$1</strong>")
+	text = markupItalic.ReplaceAllString(text, "<em>$1</em>")
+
+	for i, code := range codes {
+		text = strings.Replace(text, fmt.Sprintf("\x00%d\x00", i), code, 1)
+	}
+	return text
+}
+
+// safeLink допускает в ссылках только адреса http(s) и mailto
+func safeLink(url string) bool {
+	lower := strings.ToLower(url)
+	return strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "mailto:")
+}
+
+// validImage проверяет адрес изображения вопроса: допускаются адреса http(s)
+// и пути от корня сайта, например /static/q1.png
+func validImage(src string) bool {
+	lower := strings.ToLower(src)
+	if strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://") {
+		return true
+	}
+	return strings.HasPrefix(src, "/") && !strings.HasPrefix(src, "//")
+}
@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestRenderHelpText(t *testing.T) {
+	for text, want := range map[string]string{
+		"Первая строка\nвторая\n\nАбзац":      "<p>Первая строка<br>вторая</p><p>Абзац</p>",
+		"- **важно**\n- *курсив* и `**код**`": "<ul><li><strong>важно</strong></li><li><em>курсив</em> и <code>**код**</code></li></ul>",
+		"[правила](https://example.com/r)":    `<p><a href="https://example.com/r" target="_blank" rel="noopener noreferrer">правила</a></p>`,
+		"[ссылка](javascript:void)":           "<p>ссылка</p>",
+		"<script>alert(1)</script>":           "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>",
+	} {
+		if got := string(renderHelpText(text)); got != want {
+			t.Errorf("%q:\n%s\nожидалось\n%s", text, got, want)
+		}
+	}
+}
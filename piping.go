@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// pipePattern находит подстановки ответов вида {{q1}} в тексте вопросов и вариантов
+var pipePattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_\-]+)\s*\}\}`)
+
+// pipeRefs возвращает ID вопросов, на ответы которых ссылается текст
+func pipeRefs(text string) []string {
+	var refs []string
+	for _, m := range pipePattern.FindAllStringSubmatch(text, -1) {
+		refs = append(refs, m[1])
+	}
+	return refs
+}
+
+// pipedAnswers формирует текст подстановки для каждого вопроса, на который
+// уже получен ответ: подписи выбранных вариантов через запятую
+func pipedAnswers(questions []QuestionData, responses map[string][]string) map[string]string {
+	answers := make(map[string]string)
+	for _, q := range questions {
+		values, ok := responses[q.ID]
+		if !ok || len(values) == 0 {
+			continue
+		}
+		answers[q.ID] = strings.Join(optionLabels(q.Options, values), ", ")
+	}
+	return answers
+}
+
+// pipeText заменяет подстановки в тексте ответами; подстановки без ответа
+// заменяются пустой строкой
+func pipeText(text string, answers map[string]string) string {
+	return pipePattern.ReplaceAllStringFunc(text, func(match string) string {
+		return answers[pipePattern.FindStringSubmatch(match)[1]]
+	})
+}
+
+// pipeRefLabels возвращает замены подстановок для описаний столбцов выгрузки:
+// вместо ответа, который у каждой сессии свой, указывается ID вопроса в
+// квадратных скобках
+func pipeRefLabels(questions []QuestionData) map[string]string {
+	labels := make(map[string]string, len(questions))
+	for _, q := range questions {
+		labels[q.ID] = "[" + q.ID + "]"
+	}
+	return labels
+}
+
+// pipeQuestion возвращает копию вопроса с подставленными ответами в тексте
+// и подписях вариантов
+func pipeQuestion(q QuestionData, answers map[string]string) QuestionData {
+	q.Text = pipeText(q.Text, answers)
+	options := make([]Option, len(q.Options))
+	for i, o := range q.Options {
+		o.Label = pipeText(o.Label, answers)
+		options[i] = o
+	}
+	q.Options = options
+	return q
+}
+
+// pipeHTML подготавливает текст с подстановками для шаблона. Известные на
+// сервере ответы подставляются сразу, остальные выводятся как элементы,
+// которые заполняются на странице по мере ответа. Весь текст экранируется.
+func pipeHTML(text string, answers map[string]string) template.HTML {
+	var b strings.Builder
+	last := 0
+	for _, m := range pipePattern.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(template.HTMLEscapeString(text[last:m[0]]))
+		id := text[m[2]:m[3]]
+		if answer, ok := answers[id]; ok {
+			b.WriteString(template.HTMLEscapeString(answer))
+		} else {
+			fmt.Fprintf(&b, `<span class="pipe" data-pipe="%s"></span>`, template.HTMLEscapeString(id))
+		}
+		last = m[1]
+	}
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+	return template.HTML(b.String())
+}
+
+// pipeProblems проверяет, что подстановки ссылаются только на вопросы,
+// которые стоят раньше и ответ на которые можно показать текстом
+func pipeProblems(survey *Survey) []problem {
+	position := make(map[string]int, len(survey.Questions))
+	for i, q := range survey.Questions {
+		position[q.ID] = i
+	}
+
+	var problems []problem
+	for i, q := range survey.Questions {
+		add := func(field, format string, args ...interface{}) {
+			problems = append(problems, problem{
+				Path:    questionPath(i, field),
+				Message: fmt.Sprintf("вопрос #%d: "+format, append([]interface{}{i + 1}, args...)...),
+			})
+		}
+
+		texts := map[string]string{"text": q.Text}
+		fields := []string{"text"}
+		for j, o := range q.Options {
+			field := fmt.Sprintf("options[%d]", j)
+			texts[field] = o.Label
+			fields = append(fields, field)
+		}
+		// Подстановки в переводах проверяются так же, как в основном тексте
+		for _, lang := range sortedTranslations(q.Translations) {
+			t := q.Translations[lang]
+			field := "translations." + lang + ".text"
+			texts[field] = t.Text
+			fields = append(fields, field)
+			for _, value := range sortedStrings(t.Options) {
+				field := "translations." + lang + ".options." + value
+				texts[field] = t.Options[value]
+				fields = append(fields, field)
+			}
+		}
+
+		for _, field := range fields {
+			refs := pipeRefs(texts[field])
+			if len(refs) > 0 && survey.RandomizeQuestions {
+				add(field, "подстановки ответов несовместимы с перемешиванием вопросов")
+				continue
+			}
+			for _, ref := range refs {
+				pos, exists := position[ref]
+				if !exists {
+					add(field, "подстановка ссылается на неизвестный вопрос %s", ref)
+					continue
+				}
+				if pos >= i {
+					add(field, "подстановка ссылается на вопрос %s, который идет не раньше текущего", ref)
+					continue
+				}
+				switch survey.Questions[pos].Type {
+				case TypeMatrix, TypeFileUpload:
+					add(field, "ответ на вопрос %s типа %s нельзя подставить в текст", ref, survey.Questions[pos].Type)
+				}
+			}
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,656 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// erasureReason — причина удаления в журнале аудита по умолчанию
+const erasureReason = "запрос на удаление данных респондента"
+
+// errRespondentNotFound возвращается, если по запросу не найдено ни одной сессии
+var errRespondentNotFound = errors.New("данные респондента не найдены")
+
+// errRespondentLookup возвращается, если сессии нельзя найти по email или
+// телефону, потому что журнал доставки не содержит их хешей
+var errRespondentLookup = errors.New("поиск по email или телефону недоступен")
+
+// minRespondentKeyLength — минимальная длина ключа respondent_key
+const minRespondentKeyLength = 32
+
+// RespondentQuery — запрос данных респондента: по ID сессии или по
+// идентификатору респондента, то есть email или телефону из его ответов
+type RespondentQuery struct {
+	SessionID  string
+	Respondent string
+}
+
+// validate проверяет, что задан ровно один критерий поиска
+func (q RespondentQuery) validate() error {
+	if (q.SessionID == "") == (q.Respondent == "") {
+		return fmt.Errorf("укажите ID сессии или идентификатор респондента")
+	}
+	if q.SessionID != "" {
+		if _, err := uuid.Parse(q.SessionID); err != nil {
+			return fmt.Errorf("некорректный ID сессии %s", q.SessionID)
+		}
+	}
+	return nil
+}
+
+// Artifact — объект хранилища с данными сессии респондента. Сессия, которая
+// есть только в памяти сервера, указывается без ключа.
+type Artifact struct {
+	SessionID string `json:"session_id"`
+	// Kind — вид данных: responses, audio, upload, archive, delivery или session
+	Kind string `json:"kind"`
+	Key  string `json:"key,omitempty"`
+}
+
+// Aggregate — общий файл многих сессий (журнал JSONL или сводный набор
+// данных), в котором есть строка сессии респондента
+type Aggregate struct {
+	SessionID string `json:"session_id"`
+	Key       string `json:"key"`
+	// Encrypted — файл зашифрован: сервер не может ни выгрузить, ни удалить
+	// из него строку сессии
+	Encrypted bool `json:"encrypted,omitempty"`
+}
+
+// RespondentData — все найденные данные респондента
+type RespondentData struct {
+	Sessions   []string    `json:"sessions"`
+	Artifacts  []Artifact  `json:"artifacts"`
+	Aggregates []Aggregate `json:"aggregates,omitempty"`
+}
+
+// Tombstone — запись об удалении данных сессии по запросу респондента.
+// Хранится вместо удаленных данных и не содержит ответов.
+type Tombstone struct {
+	SessionID string    `json:"session_id"`
+	ErasedAt  time.Time `json:"erased_at"`
+	Reason    string    `json:"reason"`
+	Deleted   []string  `json:"deleted"`
+	Redacted  []string  `json:"redacted,omitempty"`
+	// Retained — зашифрованные общие файлы, строки сессии в которых должен
+	// удалить владелец закрытого ключа
+	Retained []string `json:"retained,omitempty"`
+}
+
+// respondentIdentifiers возвращает идентификаторы респондента из ответов
+// сессии на вопросы типов email и phone
+func respondentIdentifiers(session *Session) []string {
+	var values []string
+	for _, q := range session.Survey.Questions {
+		if q.Type != TypeEmail && q.Type != TypePhone {
+			continue
+		}
+		if value, ok := session.Typed[q.ID].(string); ok && value != "" {
+			values = append(values, strings.ToLower(value))
+		}
+	}
+	return values
+}
+
+// respondentLookup сообщает, можно ли искать сессии по хешам
+// идентификаторов в журнале доставки, и если нет, то почему
+func (rh *ResponseHandler) respondentLookup() error {
+	if rh.Encrypted() {
+		return fmt.Errorf("%w: при шифровании хранилища журнал доставки не содержит хешей, найдите ID сессии в расшифрованных ответах", errRespondentLookup)
+	}
+	if rh.respondentKey == "" {
+		return fmt.Errorf("%w: не задан ключ respondent_key", errRespondentLookup)
+	}
+	return nil
+}
+
+// respondentHashes возвращает хеши идентификаторов респондента для журнала
+// доставки. Журнал хранится открыто, поэтому при шифровании хранилища хеши
+// не записываются: идентификаторы остаются только в зашифрованных ответах.
+func (rh *ResponseHandler) respondentHashes(session *Session) []string {
+	if rh.respondentLookup() != nil {
+		return nil
+	}
+	var hashes []string
+	for _, value := range respondentIdentifiers(session) {
+		hashes = append(hashes, rh.hashIdentifier(value))
+	}
+	return hashes
+}
+
+// hashIdentifier возвращает HMAC-SHA256 нормализованного идентификатора с
+// секретным ключом сервера. Простой хеш email или телефона восстанавливается
+// перебором, а без ключа перебор невозможен.
+func (rh *ResponseHandler) hashIdentifier(value string) string {
+	mac := hmac.New(sha256.New, []byte(rh.respondentKey))
+	mac.Write([]byte(strings.ToLower(value)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// normalizeIdentifier приводит email или телефон к виду, в котором он
+// сохраняется в ответах
+func normalizeIdentifier(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	questionType := TypePhone
+	if strings.Contains(raw, "@") {
+		questionType = TypeEmail
+	}
+	value, err := parseTypedAnswer(QuestionData{Type: questionType}, raw)
+	if err != nil {
+		return "", fmt.Errorf("некорректный email или телефон %s", raw)
+	}
+	return value.(string), nil
+}
+
+// respondentSessions находит записи журнала доставки сессий по запросу.
+// Для сессии без записи в журнале возвращается запись только с ее ID.
+func (rh *ResponseHandler) respondentSessions(query RespondentQuery) ([]*Delivery, error) {
+	if query.SessionID != "" {
+		delivery, err := rh.loadDelivery(rh.deliveryKey(query.SessionID))
+		if errors.Is(err, os.ErrNotExist) {
+			return []*Delivery{{SessionID: query.SessionID}}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []*Delivery{delivery}, nil
+	}
+
+	value, err := normalizeIdentifier(query.Respondent)
+	if err != nil {
+		return nil, err
+	}
+	if err := rh.respondentLookup(); err != nil {
+		return nil, err
+	}
+	hash := rh.hashIdentifier(value)
+	deliveries, err := rh.Deliveries()
+	if err != nil {
+		return nil, err
+	}
+	var found []*Delivery
+	for _, delivery := range deliveries {
+		if contains(delivery.Respondents, hash) {
+			found = append(found, delivery)
+		}
+	}
+	return found, nil
+}
+
+// FindRespondent находит все данные сессий респондента в хранилище: файлы,
+// в ключах которых есть ID сессии, и общие файлы со строками этих сессий
+func (rh *ResponseHandler) FindRespondent(query RespondentQuery) (RespondentData, error) {
+	var data RespondentData
+	if err := query.validate(); err != nil {
+		return data, err
+	}
+	deliveries, err := rh.respondentSessions(query)
+	if err != nil {
+		return data, err
+	}
+	keys, err := rh.storage.List("")
+	if err != nil {
+		return data, err
+	}
+
+	for _, delivery := range deliveries {
+		sessionID := delivery.SessionID
+		data.Sessions = append(data.Sessions, sessionID)
+		data.Artifacts = append(data.Artifacts, rh.sessionArtifacts(sessionID, keys)...)
+
+		aggregates, err := rh.sessionAggregates(delivery, keys)
+		if err != nil {
+			return data, err
+		}
+		data.Aggregates = append(data.Aggregates, aggregates...)
+	}
+	return data, nil
+}
+
+// sessionArtifacts возвращает файлы сессии: объекты, в ключах которых есть ее ID
+func (rh *ResponseHandler) sessionArtifacts(sessionID string, keys []string) []Artifact {
+	var artifacts []Artifact
+	for _, key := range keys {
+		if strings.Contains(key, sessionID) && !rh.isService(key) {
+			artifacts = append(artifacts, Artifact{SessionID: sessionID, Kind: rh.artifactKind(key), Key: key})
+		}
+	}
+	return artifacts
+}
+
+// isService сообщает, что объект относится к служебным данным, которые не
+// выгружаются и не удаляются по запросу респондента
+func (rh *ResponseHandler) isService(key string) bool {
+	return strings.HasPrefix(key, rh.prefixes.Audit+"/") || strings.HasPrefix(key, rh.prefixes.Tombstones+"/")
+}
+
+// artifactKind определяет вид данных сессии по ключу объекта
+func (rh *ResponseHandler) artifactKind(key string) string {
+	name := path.Base(key)
+	switch {
+	case strings.HasPrefix(key, rh.prefixes.Deliveries+"/"):
+		return "delivery"
+	case strings.HasPrefix(key, rh.prefixes.Files+"/"):
+		return "upload"
+	case strings.HasPrefix(name, "audio_"):
+		return "audio"
+	case strings.HasPrefix(name, "results_"):
+		return "archive"
+	case strings.HasPrefix(name, "responses_"):
+		return "responses"
+	default:
+		return "file"
+	}
+}
+
+// isAggregate сообщает, что объект — общий файл многих сессий: журнал JSONL
+// или сводный набор данных
+func (rh *ResponseHandler) isAggregate(key string) bool {
+	name := strings.TrimSuffix(key, encryptedSuffix)
+	return strings.HasPrefix(key, rh.prefixes.Datasets+"/") ||
+		(strings.HasPrefix(key, rh.prefixes.Responses+"/") && strings.HasSuffix(name, ".jsonl"))
+}
+
+// sessionAggregates находит общие файлы со строкой сессии. Если опрос сессии
+// известен из журнала доставки, проверяются только журнал и набор данных его
+// версии. Незашифрованные файлы читаются, чтобы убедиться, что строка в них
+// есть; зашифрованные указываются без проверки.
+func (rh *ResponseHandler) sessionAggregates(delivery *Delivery, keys []string) ([]Aggregate, error) {
+	var aggregates []Aggregate
+	for _, key := range keys {
+		if !rh.isAggregate(key) {
+			continue
+		}
+		if delivery.SurveyID != "" && key != rh.logKey(delivery.SurveyID) &&
+			key != rh.datasetKey(delivery.SurveyID, delivery.SurveyVersion) {
+			continue
+		}
+		if strings.HasSuffix(key, encryptedSuffix) {
+			aggregates = append(aggregates, Aggregate{SessionID: delivery.SessionID, Key: key, Encrypted: true})
+			continue
+		}
+		content, err := rh.readPlain(key)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Contains(content, []byte(delivery.SessionID)) {
+			aggregates = append(aggregates, Aggregate{SessionID: delivery.SessionID, Key: key})
+		}
+	}
+	return aggregates, nil
+}
+
+// readPlain читает незашифрованный объект целиком
+func (rh *ResponseHandler) readPlain(key string) ([]byte, error) {
+	body, err := rh.plain.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть %s: %w", key, err)
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// splitAggregate разделяет содержимое общего файла на строки сессии и
+// остальные строки. В наборе данных CSV заголовок попадает в обе части.
+func splitAggregate(key string, content []byte, sessionID string) (own, rest []byte, err error) {
+	var ownBuf, restBuf bytes.Buffer
+	if strings.HasSuffix(key, ".jsonl") {
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		scanner.Buffer(nil, maxFormMemory)
+		for scanner.Scan() {
+			var record struct {
+				SessionID string `json:"session_id"`
+			}
+			line := scanner.Bytes()
+			target := &restBuf
+			if json.Unmarshal(line, &record) == nil && record.SessionID == sessionID {
+				target = &ownBuf
+			}
+			target.Write(line)
+			target.WriteByte('\n')
+		}
+		return ownBuf.Bytes(), restBuf.Bytes(), scanner.Err()
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	ownWriter, restWriter := csv.NewWriter(&ownBuf), csv.NewWriter(&restBuf)
+	column := -1
+	for i, record := range records {
+		if i == 0 {
+			column = indexOf(record, "session_id")
+			ownWriter.Write(record)
+			restWriter.Write(record)
+			continue
+		}
+		if column >= 0 && column < len(record) && record[column] == sessionID {
+			ownWriter.Write(record)
+		} else {
+			restWriter.Write(record)
+		}
+	}
+	ownWriter.Flush()
+	restWriter.Flush()
+	if err := ownWriter.Error(); err != nil {
+		return nil, nil, err
+	}
+	return ownBuf.Bytes(), restBuf.Bytes(), restWriter.Error()
+}
+
+// indexOf возвращает позицию строки в списке или -1
+func indexOf(list []string, value string) int {
+	for i, item := range list {
+		if item == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// WriteRespondentBundle записывает zip-архив с данными респондента: опись
+// manifest.json, файлы сессий в том виде, в каком они хранятся (в том числе
+// зашифрованными), строки сессий из незашифрованных общих файлов и записи
+// сессий, которые есть в памяти сервера (sessions)
+func (rh *ResponseHandler) WriteRespondentBundle(w io.Writer, data RespondentData, sessions []*Session) error {
+	zipWriter := zip.NewWriter(w)
+	manifest, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeZipEntry(zipWriter, "manifest.json", bytes.NewReader(manifest)); err != nil {
+		return err
+	}
+
+	for _, artifact := range data.Artifacts {
+		if artifact.Key == "" {
+			continue
+		}
+		body, err := rh.storage.Get(artifact.Key)
+		if err != nil {
+			return fmt.Errorf("не удалось открыть %s: %w", artifact.Key, err)
+		}
+		err = writeZipEntry(zipWriter, path.Join(artifact.SessionID, artifact.Key), body)
+		body.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, aggregate := range data.Aggregates {
+		if aggregate.Encrypted {
+			continue
+		}
+		content, err := rh.readPlain(aggregate.Key)
+		if err != nil {
+			return err
+		}
+		own, _, err := splitAggregate(aggregate.Key, content, aggregate.SessionID)
+		if err != nil {
+			return fmt.Errorf("ошибка чтения %s: %w", aggregate.Key, err)
+		}
+		if err := writeZipEntry(zipWriter, path.Join(aggregate.SessionID, aggregate.Key), bytes.NewReader(own)); err != nil {
+			return err
+		}
+	}
+
+	for _, session := range sessions {
+		record, err := json.MarshalIndent(newSessionRecord(session, session.SubmitTime), "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeZipEntry(zipWriter, path.Join(session.ID, "session.json"), bytes.NewReader(record)); err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
+
+// writeZipEntry добавляет в архив файл с содержимым из r
+func writeZipEntry(zipWriter *zip.Writer, name string, r io.Reader) error {
+	entry, err := zipWriter.Create(name)
+	if err != nil {
+		return fmt.Errorf("не удалось создать файл в архиве: %w", err)
+	}
+	_, err = io.Copy(entry, r)
+	return err
+}
+
+// EraseRespondent безвозвратно удаляет найденные данные респондента: файлы
+// сессий и их строки в незашифрованных общих файлах. Каждое удаление
+// записывается в журнал аудита, а для каждой сессии сохраняется запись
+// Tombstone.
+func (rh *ResponseHandler) EraseRespondent(data RespondentData, reason string) ([]Tombstone, error) {
+	if reason == "" {
+		reason = erasureReason
+	}
+	// Общие файлы переписываются, поэтому новые ответы ждут окончания удаления
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	var tombstones []Tombstone
+	for _, sessionID := range data.Sessions {
+		tombstone := Tombstone{SessionID: sessionID, ErasedAt: time.Now().UTC(), Reason: reason, Deleted: []string{}}
+		for _, artifact := range data.Artifacts {
+			if artifact.SessionID != sessionID || artifact.Key == "" {
+				continue
+			}
+			if err := rh.deleteFile(artifact.Key, sessionID, reason); err != nil {
+				return tombstones, err
+			}
+			tombstone.Deleted = append(tombstone.Deleted, artifact.Key)
+		}
+
+		for _, aggregate := range data.Aggregates {
+			if aggregate.SessionID != sessionID {
+				continue
+			}
+			if aggregate.Encrypted {
+				tombstone.Retained = append(tombstone.Retained, aggregate.Key)
+				continue
+			}
+			if err := rh.redactAggregate(aggregate.Key, sessionID, reason); err != nil {
+				return tombstones, err
+			}
+			tombstone.Redacted = append(tombstone.Redacted, aggregate.Key)
+		}
+
+		if err := rh.saveTombstone(tombstone); err != nil {
+			return tombstones, err
+		}
+		if len(tombstone.Retained) > 0 {
+			log.Printf("Внимание: строки сессии %s остались в зашифрованных файлах %s", sessionID, strings.Join(tombstone.Retained, ", "))
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+	return tombstones, nil
+}
+
+// redactAggregate удаляет строки сессии из незашифрованного общего файла
+func (rh *ResponseHandler) redactAggregate(key, sessionID, reason string) error {
+	content, err := rh.readPlain(key)
+	if err != nil {
+		return err
+	}
+	_, rest, err := splitAggregate(key, content, sessionID)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения %s: %w", key, err)
+	}
+	if err := rh.plain.Put(key, bytes.NewReader(rest)); err != nil {
+		return fmt.Errorf("не удалось перезаписать %s: %w", key, err)
+	}
+	return rh.audit(AuditRedact, key, sessionID, reason)
+}
+
+// saveTombstone сохраняет запись об удалении данных сессии
+func (rh *ResponseHandler) saveTombstone(tombstone Tombstone) error {
+	data, err := json.MarshalIndent(tombstone, "", "  ")
+	if err != nil {
+		return err
+	}
+	key := storageKey(rh.prefixes.Tombstones, fmt.Sprintf("tombstone_%s.json", tombstone.SessionID))
+	if err := rh.plain.Put(key, bytes.NewReader(append(data, '\n'))); err != nil {
+		return fmt.Errorf("не удалось сохранить запись об удалении %s: %w", key, err)
+	}
+	return nil
+}
+
+// findRespondent дополняет найденные в хранилище данные сессиями из памяти
+// сервера и возвращает эти сессии
+func (sm *SessionManager) findRespondent(query RespondentQuery) (RespondentData, []*Session, error) {
+	data, err := sm.responseHandler.FindRespondent(query)
+	if err != nil {
+		return data, nil, err
+	}
+
+	var value string
+	if query.Respondent != "" {
+		value, _ = normalizeIdentifier(query.Respondent)
+		value = strings.ToLower(value)
+	}
+	var sessions []*Session
+	var unsent []string
+	sm.mu.RLock()
+	for id, session := range sm.sessions {
+		if id == query.SessionID || (value != "" && contains(respondentIdentifiers(session), value)) {
+			sessions = append(sessions, session)
+			if !contains(data.Sessions, id) {
+				data.Sessions = append(data.Sessions, id)
+				unsent = append(unsent, id)
+			}
+			data.Artifacts = append(data.Artifacts, Artifact{SessionID: id, Kind: "session"})
+		}
+	}
+	sm.mu.RUnlock()
+
+	// У неотправленной сессии нет записи в журнале доставки, но уже могут
+	// быть файлы: аудиозапись и загруженные респондентом файлы
+	if len(unsent) > 0 {
+		keys, err := sm.responseHandler.storage.List("")
+		if err != nil {
+			return data, nil, err
+		}
+		for _, id := range unsent {
+			data.Artifacts = append(data.Artifacts, sm.responseHandler.sessionArtifacts(id, keys)...)
+		}
+	}
+
+	// Сессия без файлов и без записи в памяти — ничего не найдено
+	if len(data.Artifacts) == 0 && len(data.Aggregates) == 0 {
+		return data, nil, errRespondentNotFound
+	}
+	return data, sessions, nil
+}
+
+// HandleRespondent обслуживает запросы респондентов о доступе к данным и их
+// удалении. Респондент задается параметром session_id или respondent (email
+// или телефон из ответов):
+//
+//	GET  /admin/respondent?session_id=<id>         — опись данных в JSON
+//	GET  /admin/respondent/export?session_id=<id>  — zip-архив с данными
+//	POST /admin/respondent/delete?session_id=<id>  — удаление с записью Tombstone
+func (sm *SessionManager) HandleRespondent(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r, sm.currentConfig()) {
+		return
+	}
+
+	action := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin/respondent"), "/")
+	method := http.MethodGet
+	if action == "delete" {
+		method = http.MethodPost
+	}
+	if action != "" && action != "export" && action != "delete" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := RespondentQuery{SessionID: r.FormValue("session_id"), Respondent: r.FormValue("respondent")}
+	if err := query.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, sessions, err := sm.findRespondent(query)
+	if errors.Is(err, errRespondentNotFound) {
+		http.Error(w, "Данные респондента не найдены", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errRespondentLookup) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка поиска данных респондента: %v", err)
+		http.Error(w, "Ошибка поиска данных респондента", http.StatusInternalServerError)
+		return
+	}
+
+	switch action {
+	case "":
+		writeJSON(w, data)
+	case "export":
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="respondent_%s.zip"`, data.Sessions[0]))
+		if err := sm.responseHandler.WriteRespondentBundle(w, data, sessions); err != nil {
+			log.Printf("Ошибка выгрузки данных респондента: %v", err)
+		}
+	case "delete":
+		// Аудиозапись сохраняется в хранилище при остановке, поэтому после
+		// остановки записей данные респондента ищутся заново
+		for _, session := range sessions {
+			sm.audioRecorder.StopRecording(session.ID)
+		}
+		if len(sessions) > 0 {
+			data, sessions, err = sm.findRespondent(query)
+			if err != nil {
+				log.Printf("Ошибка поиска данных респондента: %v", err)
+				http.Error(w, "Ошибка поиска данных респондента", http.StatusInternalServerError)
+				return
+			}
+		}
+		for _, session := range sessions {
+			sm.mu.Lock()
+			delete(sm.sessions, session.ID)
+			sm.mu.Unlock()
+		}
+		tombstones, err := sm.responseHandler.EraseRespondent(data, r.FormValue("reason"))
+		if err != nil {
+			log.Printf("Ошибка удаления данных респондента: %v", err)
+			http.Error(w, "Ошибка удаления данных респондента", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, tombstones)
+	}
+}
+
+// writeJSON отправляет значение в ответе в формате JSON
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		log.Printf("Ошибка отправки ответа: %v", err)
+	}
+}
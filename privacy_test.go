@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+)
+
+// testRespondentKey — ключ respondent_key для тестов
+const testRespondentKey = "0123456789abcdef0123456789abcdef"
+
+// respondentSession создает сессию с email респондента в ответах
+func respondentSession(id, email string) *Session {
+	return &Session{
+		ID:     id,
+		Survey: &Survey{ID: DefaultSurveyID, Questions: []QuestionData{{ID: "mail", Type: TypeEmail}}},
+		Typed:  map[string]interface{}{"mail": email},
+	}
+}
+
+func TestRespondentHashesAreKeyed(t *testing.T) {
+	storage, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rh := NewResponseHandler(storage, StoragePrefixes{}, testRespondentKey)
+	session := respondentSession("5f0c8e4e-0000-4000-8000-000000000001", "anna@example.com")
+
+	hashes := rh.respondentHashes(session)
+	plain := sha256.Sum256([]byte("anna@example.com"))
+	if len(hashes) != 1 || hashes[0] == hex.EncodeToString(plain[:]) {
+		t.Fatalf("хеши %v не зависят от ключа", hashes)
+	}
+	other := NewResponseHandler(storage, StoragePrefixes{}, strings.Repeat("x", minRespondentKeyLength))
+	if other.hashIdentifier("anna@example.com") == hashes[0] {
+		t.Error("хеши с разными ключами совпадают")
+	}
+
+	if err := rh.SaveDelivery(&Delivery{SessionID: session.ID, Respondents: hashes}); err != nil {
+		t.Fatal(err)
+	}
+	found, err := rh.respondentSessions(RespondentQuery{Respondent: "Anna@Example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].SessionID != session.ID {
+		t.Errorf("по email найдены сессии %v", found)
+	}
+
+	// Без ключа хеши не записываются, а поиск по email сообщает причину
+	unkeyed := NewResponseHandler(storage, StoragePrefixes{}, "")
+	if got := unkeyed.respondentHashes(session); got != nil {
+		t.Errorf("хеши без ключа: %v", got)
+	}
+	if _, err := unkeyed.respondentSessions(RespondentQuery{Respondent: "anna@example.com"}); !errors.Is(err, errRespondentLookup) {
+		t.Errorf("поиск без ключа: %v", err)
+	}
+}
+
+func TestRespondentHashesSkippedWhenEncrypted(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewEncryptedStorage(local, EncryptionConfig{Recipients: []string{identity.Recipient().String()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rh := NewResponseHandler(storage, StoragePrefixes{}, testRespondentKey)
+	if got := rh.respondentHashes(respondentSession("s1", "anna@example.com")); got != nil {
+		t.Errorf("хеши в открытом журнале доставки при шифровании: %v", got)
+	}
+	if _, err := rh.respondentSessions(RespondentQuery{Respondent: "anna@example.com"}); !errors.Is(err, errRespondentLookup) {
+		t.Errorf("поиск при шифровании: %v", err)
+	}
+}
+
+func TestSettingsProblemsRespondentKey(t *testing.T) {
+	for key, valid := range map[string]bool{"": true, "short": false, testRespondentKey: true} {
+		config := &Config{RespondentKey: key}
+		found := false
+		for _, p := range settingsProblems(config) {
+			found = found || p.Path == "respondent_key"
+		}
+		if found == valid {
+			t.Errorf("ключ %q: проблема respondent_key %v", key, found)
+		}
+	}
+}
+
+// slowStream — аудиопоток, который закрывается с задержкой, как
+// настоящий поток portaudio
+type slowStream struct{}
+
+func (slowStream) Stop() error { return nil }
+
+func (slowStream) Close() error {
+	time.Sleep(50 * time.Millisecond)
+	return nil
+}
+
+func TestEraseStopsActiveRecording(t *testing.T) {
+	sm := newTestManager(t, `{
+		"smtp_host": "127.0.0.1", "smtp_port": 1,
+		"admin_token": "secret",
+		"email": {"to": "a@example.com", "from": "a@example.com"},
+		"questions": [{"id": "name", "text": "Имя", "type": "text"}]
+	}`)
+	session := sm.newSession(sm.currentConfig().DefaultSurvey())
+	session.AudioKey = sm.responseHandler.AudioKey(session)
+
+	// Запись идет: файл WAV появится в хранилище только после остановки
+	ar := sm.audioRecorder
+	recording := &Recording{
+		stream:   slowStream{},
+		buffer:   []int16{1, 2, 3},
+		key:      session.AudioKey,
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	ar.mu.Lock()
+	ar.recordings[session.ID] = recording
+	ar.mu.Unlock()
+	go ar.finish(recording)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/respondent/delete?session_id="+session.ID, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	sm.HandleRespondent(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("удаление: %d %s", rec.Code, rec.Body.String())
+	}
+	var tombstones []Tombstone
+	if err := json.Unmarshal(rec.Body.Bytes(), &tombstones); err != nil {
+		t.Fatalf("%v: %s", err, rec.Body.String())
+	}
+	if len(tombstones) != 1 || !contains(tombstones[0].Deleted, session.AudioKey) {
+		t.Errorf("аудиозапись не удалена: %s", rec.Body.String())
+	}
+
+	select {
+	case <-recording.done:
+	default:
+		t.Fatal("удаление завершилось до сохранения записи")
+	}
+	if exists, err := sm.responseHandler.storage.Exists(session.AudioKey); err != nil || exists {
+		t.Errorf("аудиозапись осталась в хранилище: %v %v", exists, err)
+	}
+	if _, exists := sm.getSession(session.ID); exists {
+		t.Error("сессия осталась в памяти")
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Форматы нормализованного экспорта дат
+const (
+	exportDateFormat     = "2006-01-02"
+	exportDateTimeFormat = time.RFC3339
+)
+
+// exportItem представляет одну строку экспорта ответа
+type exportItem struct {
+	ID     string
+	Text   string
+	Type   QuestionType
+	Values []string
+	// Labels содержит подписи выбранных вариантов в том же порядке, что и Values
+	Labels []string
+}
+
+// presentQuestions возвращает вопросы в порядке показа для сессии.
+// Порядок определяется зерном сессии, поэтому при повторной загрузке
+// страницы респондент видит те же вопросы в том же порядке.
+func presentQuestions(survey *Survey, seed int64) []QuestionData {
+	questions := make([]QuestionData, len(survey.Questions))
+	copy(questions, survey.Questions)
+
+	if survey.RandomizeQuestions {
+		rng := rand.New(rand.NewSource(seed))
+		rng.Shuffle(len(questions), func(i, j int) {
+			questions[i], questions[j] = questions[j], questions[i]
+		})
+	}
+
+	for i, q := range questions {
+		if q.RandomizeOptions {
+			questions[i].Options = shuffleOptions(q.Options, seed^questionSeed(q.ID))
+		}
+	}
+
+	return questions
+}
+
+// shuffleOptions перемешивает варианты ответа, оставляя закрепленные
+// варианты в конце списка в исходном порядке
+func shuffleOptions(options []Option, seed int64) []Option {
+	shuffled := make([]Option, 0, len(options))
+	var pinned []Option
+	for _, o := range options {
+		if o.Pin {
+			pinned = append(pinned, o)
+		} else {
+			shuffled = append(shuffled, o)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	rng.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	return append(shuffled, pinned...)
+}
+
+// questionSeed вычисляет добавку к зерну сессии для вопроса, чтобы варианты
+// разных вопросов перемешивались независимо
+func questionSeed(id string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return int64(h.Sum64())
+}
+
+// collectAnswers извлекает ответы на вопрос из формы и проверяет их.
+// Для вопросов с типизированным вводом дополнительно возвращает разобранные
+// значения, а строковый ответ приводится к нормализованному виду.
+func collectAnswers(q QuestionData, form url.Values) (map[string][]string, map[string]interface{}, error) {
+	answers := make(map[string][]string)
+	typed := make(map[string]interface{})
+
+	switch q.Type {
+	case TypeMatrix:
+		for i, row := range q.Rows {
+			rowID := q.ItemID(i)
+			values := form[rowID]
+			if len(values) == 0 && q.Required {
+				return nil, nil, localizedErrorf("answer.row_missing", row, q.Text)
+			}
+			if len(values) > 1 && !q.MultiSelect {
+				return nil, nil, localizedErrorf("answer.row_single", row, q.Text)
+			}
+			for _, v := range values {
+				if !contains(optionValues(q.Columns), v) {
+					return nil, nil, localizedErrorf("answer.row_invalid", v, row)
+				}
+			}
+			answers[rowID] = values
+		}
+	case TypeNumber, TypeDate, TypeDateTime, TypeEmail, TypePhone:
+		raw := strings.TrimSpace(form.Get(q.ID))
+		if raw == "" {
+			if q.Required {
+				return nil, nil, localizedErrorf("answer.missing", q.Text)
+			}
+			answers[q.ID] = nil
+			break
+		}
+		value, err := parseTypedAnswer(q, raw)
+		if err != nil {
+			return nil, nil, localizedErrorf("answer.question", q.Text, err)
+		}
+		typed[q.ID] = value
+		answers[q.ID] = []string{formatTypedAnswer(q, value)}
+	case TypeFileUpload:
+		// Файлы обрабатываются отдельно в collectUploads
+	case TypeRanking:
+		values := form[q.ID]
+		// Порядок по умолчанию отправляется всегда, поэтому для необязательного
+		// вопроса ответ учитывается, только если респондент менял порядок
+		if !q.Required && form.Get(q.ID+"_touched") == "" {
+			answers[q.ID] = nil
+			break
+		}
+		if !isPermutation(values, optionValues(q.Options)) {
+			return nil, nil, localizedErrorf("answer.permutation", q.Text)
+		}
+		answers[q.ID] = values
+	default:
+		values := form[q.ID]
+		if len(q.Options) > 0 {
+			for _, v := range values {
+				if !contains(optionValues(q.Options), v) {
+					return nil, nil, localizedErrorf("answer.invalid", v, q.Text)
+				}
+			}
+		}
+		if q.Type == TypeSingleChoice && len(values) > 1 {
+			return nil, nil, localizedErrorf("answer.single", q.Text)
+		}
+		// Для вопросов с произвольным ответом добавляем его отдельно
+		if q.AllowCustom {
+			customAnswer := form.Get(q.ID + "_custom")
+			if customAnswer != "" {
+				values = append(values, customAnswer)
+			}
+		}
+		answers[q.ID] = values
+	}
+
+	return answers, typed, nil
+}
+
+// collectUploads извлекает файлы, загруженные в ответ на вопрос, и проверяет
+// их количество, размер и тип
+func collectUploads(q QuestionData, form *multipart.Form) ([]*multipart.FileHeader, error) {
+	var files []*multipart.FileHeader
+	if form != nil {
+		files = form.File[q.ID]
+	}
+
+	if len(files) == 0 {
+		if q.Required {
+			return nil, localizedErrorf("answer.no_file", q.Text)
+		}
+		return nil, nil
+	}
+	if len(files) > q.FileLimit() {
+		return nil, localizedErrorf("answer.too_many", q.Text, q.FileLimit())
+	}
+
+	for _, fh := range files {
+		if fh.Size > q.UploadLimit() {
+			return nil, localizedErrorf("answer.file_size", fh.Filename, q.UploadLimitMB())
+		}
+		if len(q.AllowedTypes) > 0 {
+			contentType, err := detectUploadType(fh)
+			if err != nil {
+				return nil, err
+			}
+			if !mimeAllowed(contentType, q.AllowedTypes) {
+				return nil, localizedErrorf("answer.file_type", fh.Filename, contentType)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// Документы Office, которые не распознаются по сигнатуре: форматы Office
+// Open XML определяются как zip, старые форматы — как двоичные данные.
+// Для каждого расширения указан каталог основной части документа в архиве
+// или пустая строка для составного документа OLE.
+var officeTypes = map[string]struct{ contentType, part string }{
+	".docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "word/"},
+	".xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xl/"},
+	".pptx": {"application/vnd.openxmlformats-officedocument.presentationml.presentation", "ppt/"},
+	".doc":  {"application/msword", ""},
+	".xls":  {"application/vnd.ms-excel", ""},
+	".ppt":  {"application/vnd.ms-powerpoint", ""},
+}
+
+// oleSignature — сигнатура составного документа OLE
+var oleSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// detectUploadType определяет MIME-тип загруженного файла по его содержимому.
+// Расширение файла уточняет тип, только если содержимое ему соответствует:
+// текст — для текстовых форматов (например, csv), zip — для документов
+// Office Open XML с нужной структурой архива, двоичные данные — для старых
+// документов Office с сигнатурой OLE. Иначе возвращается тип по содержимому.
+func detectUploadType(fh *multipart.FileHeader) (string, error) {
+	file, err := fh.Open()
+	if err != nil {
+		return "", fmt.Errorf("не удалось прочитать файл «%s»: %w", fh.Filename, err)
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, _ := file.Read(head)
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+
+	ext := strings.ToLower(filepath.Ext(fh.Filename))
+	office, isOffice := officeTypes[ext]
+	switch contentType {
+	case "text/plain":
+		byExt, _, err := mime.ParseMediaType(mime.TypeByExtension(ext))
+		if err == nil && (strings.HasPrefix(byExt, "text/") || byExt == "application/json") {
+			return byExt, nil
+		}
+	case "application/zip":
+		if isOffice && office.part != "" && isOfficeArchive(file, fh.Size, office.part) {
+			return office.contentType, nil
+		}
+	case "application/octet-stream":
+		if isOffice && office.part == "" && bytes.HasPrefix(head[:n], oleSignature) {
+			return office.contentType, nil
+		}
+	}
+	return contentType, nil
+}
+
+// isOfficeArchive проверяет, что zip-архив — документ Office Open XML:
+// в нем есть описание типов [Content_Types].xml и основная часть документа
+func isOfficeArchive(file io.ReaderAt, size int64, part string) bool {
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		return false
+	}
+	var types, main bool
+	for _, f := range archive.File {
+		types = types || f.Name == "[Content_Types].xml"
+		main = main || strings.HasPrefix(f.Name, part)
+	}
+	return types && main
+}
+
+// mimeAllowed проверяет тип по списку разрешенных, поддерживая шаблоны вида image/*
+func mimeAllowed(contentType string, allowed []string) bool {
+	for _, pattern := range allowed {
+		if pattern == contentType {
+			return true
+		}
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDefault проверяет, что ответ по умолчанию допустим для вопроса:
+// выбранные варианты есть среди вариантов ответа, а введенное значение
+// проходит ту же проверку, что и ответ респондента
+func validateDefault(q QuestionData) error {
+	switch q.Type {
+	case TypeSingleChoice, TypeMultiChoice, TypeMixed:
+		if q.Type == TypeSingleChoice && len(q.Default) > 1 {
+			return fmt.Errorf("для вопроса с одним ответом допускается одно значение")
+		}
+		values := optionValues(q.Options)
+		for _, value := range q.Default {
+			if !contains(values, value) {
+				return fmt.Errorf("варианта «%s» нет среди вариантов ответа", value)
+			}
+		}
+	case TypeText, TypeNumber, TypeDate, TypeDateTime, TypeEmail, TypePhone:
+		if len(q.Default) > 1 {
+			return fmt.Errorf("для вопроса типа %s допускается одно значение", q.Type)
+		}
+		if q.Type != TypeText {
+			if _, err := parseTypedAnswer(q, q.Default[0]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("вопросы типа %s не поддерживают значение по умолчанию", q.Type)
+	}
+	return nil
+}
+
+// parseTypedAnswer разбирает ответ на вопрос с типизированным вводом
+func parseTypedAnswer(q QuestionData, raw string) (interface{}, error) {
+	switch q.Type {
+	case TypeNumber:
+		// Допускаем десятичную запятую, принятую в русской локали
+		value, err := strconv.ParseFloat(strings.Replace(raw, ",", ".", 1), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, localizedErrorf("answer.not_number", raw)
+		}
+		if q.Min != nil && value < *q.Min {
+			return nil, localizedErrorf("answer.min", *q.Min)
+		}
+		if q.Max != nil && value > *q.Max {
+			return nil, localizedErrorf("answer.max", *q.Max)
+		}
+		if q.Step > 0 {
+			base := 0.0
+			if q.Min != nil {
+				base = *q.Min
+			}
+			steps := (value - base) / q.Step
+			if math.Abs(steps-math.Round(steps)) > 1e-9 {
+				return nil, localizedErrorf("answer.step", q.Step)
+			}
+		}
+		return value, nil
+
+	case TypeDate:
+		for _, layout := range []string{"2006-01-02", "02.01.2006"} {
+			if t, err := time.Parse(layout, raw); err == nil {
+				return t, nil
+			}
+		}
+		return nil, localizedErrorf("answer.not_date", raw)
+
+	case TypeDateTime:
+		if t, err := time.Parse(time.RFC3339, raw); err == nil {
+			return t, nil
+		}
+		// Поле datetime-local не содержит часового пояса, используем пояс из
+		// настройки timezone
+		for _, layout := range []string{"2006-01-02T15:04", "2006-01-02T15:04:05", "02.01.2006 15:04"} {
+			if t, err := time.ParseInLocation(layout, raw, q.timezone()); err == nil {
+				return t, nil
+			}
+		}
+		return nil, localizedErrorf("answer.not_datetime", raw)
+
+	case TypeEmail:
+		addr, err := mail.ParseAddress(raw)
+		if err != nil || addr.Name != "" || addr.Address != raw {
+			return nil, localizedErrorf("answer.not_email", raw)
+		}
+		// Доменная часть адреса не зависит от регистра
+		at := strings.LastIndex(addr.Address, "@")
+		return addr.Address[:at] + strings.ToLower(addr.Address[at:]), nil
+
+	case TypePhone:
+		var digits strings.Builder
+		for i, r := range raw {
+			switch {
+			case r >= '0' && r <= '9':
+				digits.WriteRune(r)
+			case r == '+' && i == 0:
+			case strings.ContainsRune(" -().", r):
+			default:
+				return nil, localizedErrorf("answer.not_phone", raw)
+			}
+		}
+		// Ограничения длины соответствуют формату E.164
+		if digits.Len() < 7 || digits.Len() > 15 {
+			return nil, localizedErrorf("answer.not_phone", raw)
+		}
+		if strings.HasPrefix(raw, "+") {
+			return "+" + digits.String(), nil
+		}
+		return digits.String(), nil
+	}
+
+	return raw, nil
+}
+
+// formatTypedAnswer приводит типизированное значение к виду,
+// не зависящему от локали: числа с точкой, даты в ISO 8601
+func formatTypedAnswer(q QuestionData, value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		if q.Type == TypeDate {
+			return v.Format(exportDateFormat)
+		}
+		return v.Format(exportDateTimeFormat)
+	case string:
+		return v
+	}
+	return fmt.Sprint(value)
+}
+
+// exportItems разворачивает ответ на вопрос в строки экспорта.
+// Матрица экспортируется отдельной строкой на каждый свой элемент.
+func exportItems(q QuestionData, responses map[string][]string) []exportItem {
+	if q.Type == TypeMatrix {
+		items := make([]exportItem, 0, len(q.Rows))
+		for i, row := range q.Rows {
+			rowID := q.ItemID(i)
+			items = append(items, exportItem{
+				ID:     rowID,
+				Text:   fmt.Sprintf("%s — %s", q.Text, row),
+				Type:   q.Type,
+				Values: responses[rowID],
+				Labels: optionLabels(q.Columns, responses[rowID]),
+			})
+		}
+		return items
+	}
+
+	if q.Type == TypeRanking {
+		// Для каждого варианта экспортируется его позиция в рейтинге
+		ranked := responses[q.ID]
+		items := make([]exportItem, 0, len(q.Options))
+		for i, option := range q.Options {
+			var values []string
+			for pos, value := range ranked {
+				if value == option.Value {
+					values = []string{strconv.Itoa(pos + 1)}
+					break
+				}
+			}
+			items = append(items, exportItem{
+				ID:     q.ItemID(i),
+				Text:   fmt.Sprintf("%s — %s", q.Text, option.Label),
+				Type:   q.Type,
+				Values: values,
+				Labels: values,
+			})
+		}
+		return items
+	}
+
+	text := q.Text
+	if q.Type == TypeNumber && q.Unit != "" {
+		text = fmt.Sprintf("%s, %s", q.Text, q.Unit)
+	}
+
+	return []exportItem{{
+		ID:     q.ID,
+		Text:   text,
+		Type:   q.Type,
+		Values: responses[q.ID],
+		Labels: optionLabels(q.Options, responses[q.ID]),
+	}}
+}
+
+// optionLabels заменяет коды выбранных вариантов их подписями
+func optionLabels(options []Option, values []string) []string {
+	if values == nil {
+		return nil
+	}
+	labels := make([]string, len(values))
+	for i, v := range values {
+		labels[i] = optionLabel(options, v)
+	}
+	return labels
+}
+
+// isPermutation проверяет, что values содержит каждый из options ровно один раз
+func isPermutation(values, options []string) bool {
+	if len(values) != len(options) {
+		return false
+	}
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		if seen[v] || !contains(options, v) {
+			return false
+		}
+		seen[v] = true
+	}
+	return true
+}
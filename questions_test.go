@@ -0,0 +1,288 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"mime/multipart"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testQuestions загружает вопросы опроса по умолчанию из списка JSON
+func testQuestions(t *testing.T, questions string) []QuestionData {
+	t.Helper()
+	config := loadTestConfig(t, `{
+		"smtp_host": "127.0.0.1", "smtp_port": 1,
+		"email": {"to": "a@example.com", "from": "a@example.com"},
+		"questions": `+questions+`
+	}`)
+	return config.Surveys[0].Questions
+}
+
+// uploadHeader возвращает заголовок файла, загруженного через форму
+func uploadHeader(t *testing.T, name string, content []byte) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("f", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	writer.Close()
+
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File["f"][0]
+}
+
+// zipContent возвращает zip-архив с пустыми файлами names
+func zipContent(t *testing.T, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, name := range names {
+		if _, err := writer.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectUploadType(t *testing.T) {
+	docx := zipContent(t, "[Content_Types].xml", "word/document.xml")
+	ole := append(append([]byte{}, oleSignature...), make([]byte, 600)...)
+	binary := make([]byte, 600)
+	binary[0] = 0x01
+
+	for _, tc := range []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"scan.pdf", []byte("%PDF-1.4\n"), "application/pdf"},
+		{"report.pdf", []byte("plain text, not a pdf"), "text/plain"},
+		{"data.json", []byte(`{"a": 1}`), "application/json"},
+		{"letter.docx", docx, officeTypes[".docx"].contentType},
+		{"letter.docx", zipContent(t, "payload.exe"), "application/zip"},
+		{"table.xlsx", docx, "application/zip"},
+		{"letter.doc", ole, "application/msword"},
+		{"letter.doc", binary, "application/octet-stream"},
+		{"letter.docx", binary, "application/octet-stream"},
+	} {
+		got, err := detectUploadType(uploadHeader(t, tc.name, tc.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: тип %s, ожидался %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMatrixAnswers(t *testing.T) {
+	q := testQuestions(t, `[{"id": "m", "text": "Оцените", "type": "matrix", "required": true,
+		"rows": ["Цена", "Качество"], "columns": [{"value": "1", "label": "Плохо"}, {"value": "2", "label": "Хорошо"}]}]`)[0]
+
+	answers, _, err := collectAnswers(q, url.Values{"m_1": {"2"}, "m_2": {"1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string][]string{"m_1": {"2"}, "m_2": {"1"}}; !reflect.DeepEqual(answers, want) {
+		t.Errorf("ответы %v, ожидалось %v", answers, want)
+	}
+
+	items := exportItems(q, answers)
+	if len(items) != 2 || items[0].ID != "m_1" || items[0].Text != "Оцените — Цена" ||
+		!reflect.DeepEqual(items[1].Labels, []string{"Плохо"}) {
+		t.Errorf("строки экспорта %+v", items)
+	}
+
+	for name, form := range map[string]url.Values{
+		"строка без ответа":          {"m_1": {"2"}},
+		"два ответа в строке":        {"m_1": {"1", "2"}, "m_2": {"1"}},
+		"ответ не из списка колонок": {"m_1": {"3"}, "m_2": {"1"}},
+	} {
+		if _, _, err := collectAnswers(q, form); err == nil {
+			t.Errorf("%s: ответ принят", name)
+		}
+	}
+}
+
+func TestRankingAnswers(t *testing.T) {
+	questions := testQuestions(t, `[
+		{"id": "r", "text": "Приоритеты", "type": "ranking", "required": true, "options": ["Цена", "Скорость", "Сервис"]},
+		{"id": "o", "text": "Необязательный", "type": "ranking", "options": ["a", "b"]}
+	]`)
+	q := questions[0]
+
+	answers, _, err := collectAnswers(q, url.Values{"r": {"Сервис", "Цена", "Скорость"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ranks []string
+	for _, item := range exportItems(q, answers) {
+		ranks = append(ranks, item.Values...)
+	}
+	if want := []string{"2", "3", "1"}; !reflect.DeepEqual(ranks, want) {
+		t.Errorf("позиции вариантов %v, ожидалось %v", ranks, want)
+	}
+
+	for _, values := range [][]string{{"Цена", "Цена", "Сервис"}, {"Цена", "Сервис"}, {"Цена", "Сервис", "Другое"}} {
+		if _, _, err := collectAnswers(q, url.Values{"r": values}); err == nil {
+			t.Errorf("порядок %v принят", values)
+		}
+	}
+
+	// Порядок по умолчанию необязательного вопроса не считается ответом
+	answers, _, err = collectAnswers(questions[1], url.Values{"o": {"a", "b"}})
+	if err != nil || answers["o"] != nil {
+		t.Errorf("нетронутый рейтинг: %v, %v", answers, err)
+	}
+	answers, _, err = collectAnswers(questions[1], url.Values{"o": {"b", "a"}, "o_touched": {"1"}})
+	if err != nil || !reflect.DeepEqual(answers["o"], []string{"b", "a"}) {
+		t.Errorf("измененный рейтинг: %v, %v", answers, err)
+	}
+}
+
+func TestOptionCodes(t *testing.T) {
+	q := testQuestions(t, `[{"id": "c", "text": "Выбор", "type": "single_choice",
+		"options": ["Да", 5, {"value": "n", "label": "Нет"}]}]`)[0]
+	want := []Option{{Value: "Да", Label: "Да"}, {Value: "5", Label: "5"}, {Value: "n", Label: "Нет"}}
+	if !reflect.DeepEqual(q.Options, want) {
+		t.Errorf("варианты %+v, ожидалось %+v", q.Options, want)
+	}
+
+	answers, _, err := collectAnswers(q, url.Values{"c": {"n"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items := exportItems(q, answers); !reflect.DeepEqual(items[0].Values, []string{"n"}) ||
+		!reflect.DeepEqual(items[0].Labels, []string{"Нет"}) {
+		t.Errorf("экспорт %+v", items[0])
+	}
+	if _, _, err := collectAnswers(q, url.Values{"c": {"Нет"}}); err == nil {
+		t.Error("вместо кода принята подпись варианта")
+	}
+
+	survey := &Survey{ID: DefaultSurveyID, Questions: []QuestionData{{
+		ID: "c", Text: "Выбор", Type: TypeSingleChoice,
+		Options: []Option{{Value: "1", Label: "Один"}, {Value: "1", Label: "Единица"}},
+	}}}
+	found := false
+	for _, p := range surveyProblems(survey) {
+		found = found || p.Path == questionPath(0, "options[1]")
+	}
+	if !found {
+		t.Errorf("повторяющийся код не найден: %v", surveyProblems(survey))
+	}
+}
+
+func TestRandomizationIsStablePerSeed(t *testing.T) {
+	survey := &Survey{ID: DefaultSurveyID, RandomizeQuestions: true}
+	for _, id := range []string{"q1", "q2", "q3", "q4", "q5", "q6"} {
+		survey.Questions = append(survey.Questions, QuestionData{
+			ID: id, Type: TypeSingleChoice, RandomizeOptions: true,
+			Options: []Option{{Value: "a"}, {Value: "b"}, {Value: "c"}, {Value: "d"}, {Value: "other", Pin: true}},
+		})
+	}
+	order := func(seed int64) (ids []string, options [][]string) {
+		for _, q := range presentQuestions(survey, seed) {
+			ids = append(ids, q.ID)
+			options = append(options, optionValues(q.Options))
+		}
+		return ids, options
+	}
+
+	ids, options := order(42)
+	againIDs, againOptions := order(42)
+	if !reflect.DeepEqual(ids, againIDs) || !reflect.DeepEqual(options, againOptions) {
+		t.Fatalf("порядок для одного зерна отличается: %v %v и %v %v", ids, options, againIDs, againOptions)
+	}
+
+	shuffled := false
+	for seed := int64(1); seed <= 20 && !shuffled; seed++ {
+		otherIDs, _ := order(seed)
+		shuffled = !reflect.DeepEqual(otherIDs, ids)
+	}
+	if !shuffled {
+		t.Error("порядок вопросов не зависит от зерна")
+	}
+
+	independent := false
+	for _, values := range options {
+		if values[len(values)-1] != "other" {
+			t.Errorf("закрепленный вариант не в конце: %v", values)
+		}
+		independent = independent || !reflect.DeepEqual(values, options[0])
+	}
+	if !independent {
+		t.Error("варианты всех вопросов перемешаны одинаково")
+	}
+	if got := optionValues(survey.Questions[0].Options); !reflect.DeepEqual(got, []string{"a", "b", "c", "d", "other"}) {
+		t.Errorf("перемешивание изменило определение опроса: %v", got)
+	}
+}
+
+func TestSessionRecordKeepsPresentedOrder(t *testing.T) {
+	sm := newTestManager(t, `{
+		"smtp_host": "127.0.0.1", "smtp_port": 1,
+		"email": {"to": "a@example.com", "from": "a@example.com"},
+		"randomize_questions": true,
+		"questions": [
+			{"id": "q1", "text": "Один", "type": "single_choice", "options": ["a", "b", "c"], "randomize_options": true},
+			{"id": "q2", "text": "Два", "type": "text"},
+			{"id": "q3", "text": "Три", "type": "text"}
+		]
+	}`)
+	session := sm.newSession(sm.currentConfig().Surveys[0])
+	presented := sm.presentSession(session)
+
+	record := newSessionRecord(session, time.Now())
+	if !reflect.DeepEqual(record.QuestionOrder, session.QuestionOrder) || len(record.QuestionOrder) != 3 {
+		t.Errorf("порядок вопросов в записи %v, в сессии %v", record.QuestionOrder, session.QuestionOrder)
+	}
+	for _, answer := range record.Answers {
+		if presented[answer.Position-1].ID != answer.Question {
+			t.Errorf("вопрос %s записан на позиции %d", answer.Question, answer.Position)
+		}
+		if answer.Question == "q1" && !reflect.DeepEqual(answer.OptionOrder, optionValues(presented[answer.Position-1].Options)) {
+			t.Errorf("порядок вариантов %v", answer.OptionOrder)
+		}
+	}
+}
+
+func TestValidateDefault(t *testing.T) {
+	options := []Option{{Value: "a"}, {Value: "b"}}
+	one := 1.0
+	for _, tc := range []struct {
+		q     QuestionData
+		valid bool
+	}{
+		{QuestionData{Type: TypeSingleChoice, Options: options, Default: DefaultValue{"b"}}, true},
+		{QuestionData{Type: TypeSingleChoice, Options: options, Default: DefaultValue{"a", "b"}}, false},
+		{QuestionData{Type: TypeMultiChoice, Options: options, Default: DefaultValue{"a", "b"}}, true},
+		{QuestionData{Type: TypeMultiChoice, Options: options, Default: DefaultValue{"c"}}, false},
+		{QuestionData{Type: TypeNumber, Min: &one, Default: DefaultValue{"0"}}, false},
+		{QuestionData{Type: TypeDate, Default: DefaultValue{"2024-02-30"}}, false},
+		{QuestionData{Type: TypeText, Default: DefaultValue{"Москва"}}, true},
+		{QuestionData{Type: TypeRanking, Options: options, Default: DefaultValue{"a"}}, false},
+	} {
+		if err := validateDefault(tc.q); (err == nil) != tc.valid {
+			t.Errorf("%s %v: ошибка %v", tc.q.Type, tc.q.Default, err)
+		}
+	}
+
+	q := QuestionData{Type: TypeDateTime, Default: DefaultValue{"05.03.2024 14:30"}}
+	if got := q.DefaultInput(); got != "2024-03-05T14:30" {
+		t.Errorf("значение поля datetime-local %q", got)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"path"
+	"time"
+)
+
+// SessionRecord — структурированная запись о завершенной сессии для выгрузки
+// в JSON и JSONL. В отличие от CSV, ответы хранятся списками, поэтому точка с
+// запятой в тексте варианта не ломает разбор.
+type SessionRecord struct {
+	SessionID     string    `json:"session_id"`
+	SurveyID      string    `json:"survey_id"`
+	SurveyVersion string    `json:"survey_version"`
+	Language      string    `json:"language"`
+	StartedAt     time.Time `json:"started_at"`
+	// FirstInteractionAt — первое действие респондента на странице опроса
+	FirstInteractionAt *time.Time `json:"first_interaction_at,omitempty"`
+	SubmittedAt        time.Time  `json:"submitted_at"`
+	// DurationSeconds — время от начала сессии до отправки ответов
+	DurationSeconds float64 `json:"duration_seconds"`
+	// Audio и Files содержат имена файлов в архиве результатов
+	Audio         string         `json:"audio,omitempty"`
+	Files         []string       `json:"files,omitempty"`
+	QuestionOrder []string       `json:"question_order,omitempty"`
+	Answers       []AnswerRecord `json:"answers"`
+}
+
+// AnswerRecord — ответ на вопрос или на элемент составного вопроса
+// (строку матрицы, вариант рейтинга) вместе с описанием вопроса
+type AnswerRecord struct {
+	ID string `json:"id"`
+	// Question — ID вопроса, к которому относится элемент
+	Question string       `json:"question"`
+	Text     string       `json:"text"`
+	Type     QuestionType `json:"type"`
+	Required bool         `json:"required,omitempty"`
+	Values   []string     `json:"values"`
+	Labels   []string     `json:"labels,omitempty"`
+	// Value — разобранное значение вопроса с типизированным вводом: число или
+	// строка; даты записываются как в CSV (2024-03-05, время в RFC 3339). Для
+	// загруженных файлов — исходные имена файлов в порядке Values.
+	Value interface{} `json:"value,omitempty"`
+	// Position и OptionOrder — показанный респонденту порядок, если опрос
+	// перемешивает вопросы или варианты
+	Position    int      `json:"position,omitempty"`
+	OptionOrder []string `json:"option_order,omitempty"`
+	// FirstAnsweredAt, LastAnsweredAt и DwellSeconds — время работы с
+	// вопросом по данным браузера, общее для всех элементов вопроса
+	FirstAnsweredAt *time.Time `json:"first_answered_at,omitempty"`
+	LastAnsweredAt  *time.Time `json:"last_answered_at,omitempty"`
+	DwellSeconds    float64    `json:"dwell_seconds,omitempty"`
+}
+
+// newSessionRecord собирает запись сессии. Тексты вопросов берутся на
+// основном языке опроса с подставленными ответами, как и в CSV.
+func newSessionRecord(session *Session, submitted time.Time) SessionRecord {
+	survey := session.Survey
+	record := SessionRecord{
+		SessionID:          session.ID,
+		SurveyID:           survey.ID,
+		SurveyVersion:      session.SurveyVersion,
+		Language:           session.Language,
+		StartedAt:          session.StartTime,
+		FirstInteractionAt: timePointer(session.FirstInteraction),
+		SubmittedAt:        submitted,
+		DurationSeconds:    submitted.Sub(session.StartTime).Seconds(),
+		Answers:            []AnswerRecord{},
+	}
+	if session.AudioKey != "" {
+		record.Audio = path.Base(session.AudioKey)
+	}
+	for _, key := range session.Files {
+		record.Files = append(record.Files, path.Base(key))
+	}
+
+	withOrder := survey.randomized()
+	positions := make(map[string]int, len(session.QuestionOrder))
+	if withOrder {
+		record.QuestionOrder = session.QuestionOrder
+		for i, id := range session.QuestionOrder {
+			positions[id] = i + 1
+		}
+	}
+
+	answers := pipedAnswers(survey.Questions, session.Responses)
+	for _, q := range survey.Questions {
+		q = pipeQuestion(q, answers)
+		timing := session.Timings[q.ID]
+		for _, item := range exportItems(q, session.Responses) {
+			answer := AnswerRecord{
+				ID:              item.ID,
+				Question:        q.ID,
+				Text:            item.Text,
+				Type:            item.Type,
+				Required:        q.Required,
+				Values:          item.Values,
+				Value:           recordValue(q, session.Typed[item.ID]),
+				Position:        positions[q.ID],
+				FirstAnsweredAt: timePointer(timing.FirstAnswer),
+				LastAnsweredAt:  timePointer(timing.LastAnswer),
+				DwellSeconds:    timing.Dwell.Seconds(),
+			}
+			if answer.Values == nil {
+				answer.Values = []string{}
+			}
+			// Подписи нужны только там, где они отличаются от кодов
+			if q.Type == TypeSingleChoice || q.Type == TypeMultiChoice || q.Type == TypeMixed || q.Type == TypeMatrix {
+				answer.Labels = item.Labels
+			}
+			if withOrder {
+				answer.OptionOrder = session.OptionOrder[q.ID]
+			}
+			record.Answers = append(record.Answers, answer)
+		}
+	}
+	return record
+}
+
+// recordValue приводит значение вопроса с типизированным вводом к виду для
+// записи: даты и время — строками в том же формате, что и в CSV
+func recordValue(q QuestionData, value interface{}) interface{} {
+	if t, ok := value.(time.Time); ok {
+		return formatTypedAnswer(q, t)
+	}
+	return value
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRecordValueFormatsDates(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("нет базы часовых поясов: %v", err)
+	}
+	date := QuestionData{ID: "d", Type: TypeDate}
+	datetime := QuestionData{ID: "t", Type: TypeDateTime, location: tokyo}
+
+	dateValue, err := parseTypedAnswer(date, "05.03.2024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	datetimeValue, err := parseTypedAnswer(datetime, "2024-03-05T10:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal([]interface{}{
+		recordValue(date, dateValue),
+		recordValue(datetime, datetimeValue),
+		recordValue(QuestionData{Type: TypeNumber}, 2.5),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `["2024-03-05","2024-03-05T10:30:00+09:00",2.5]`
+	if string(data) != want {
+		t.Errorf("получено %s, ожидалось %s", data, want)
+	}
+}
+
+func TestSettingsProblemsTimezone(t *testing.T) {
+	for _, tc := range []struct {
+		timezone string
+		invalid  bool
+	}{
+		{"", false},
+		{"UTC", false},
+		{"Nowhere/Zone", true},
+	} {
+		found := false
+		for _, p := range settingsProblems(&Config{Timezone: tc.timezone}) {
+			if p.Path == "timezone" {
+				found = true
+			}
+		}
+		if found != tc.invalid {
+			t.Errorf("timezone %q: проблема найдена %v, ожидалось %v", tc.timezone, found, tc.invalid)
+		}
+	}
+}
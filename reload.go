@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigReloader перезагружает конфигурацию без перезапуска сервера:
+// по сигналу SIGHUP или при изменении файлов конфигурации
+type ConfigReloader struct {
+	path           string
+	sessionManager *SessionManager
+	fingerprint    string
+	mu             sync.Mutex
+}
+
+// NewConfigReloader создает новый перезагрузчик конфигурации
+func NewConfigReloader(path string, sessionManager *SessionManager) *ConfigReloader {
+	cr := &ConfigReloader{
+		path:           path,
+		sessionManager: sessionManager,
+	}
+	cr.fingerprint = cr.currentFingerprint()
+	return cr
+}
+
+// Reload загружает и проверяет конфигурацию и, если она корректна, применяет
+// ее к новым сессиям. При ошибке продолжает действовать прежняя конфигурация.
+func (cr *ConfigReloader) Reload() error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	cr.fingerprint = cr.currentFingerprint()
+
+	config, err := LoadConfig(cr.path)
+	if err != nil {
+		return fmt.Errorf("новая конфигурация отклонена: %w", err)
+	}
+	if err := cr.sessionManager.Reload(config); err != nil {
+		return fmt.Errorf("новая конфигурация отклонена: %w", err)
+	}
+
+	// Набор отслеживаемых файлов мог измениться вместе с конфигурацией
+	cr.fingerprint = cr.currentFingerprint()
+
+	log.Printf("Конфигурация перезагружена: %v", config)
+	return nil
+}
+
+// Watch периодически проверяет файлы конфигурации и перезагружает ее при
+// изменении. Завершается при закрытии канала stop.
+func (cr *ConfigReloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			cr.mu.Lock()
+			changed := cr.currentFingerprint() != cr.fingerprint
+			cr.mu.Unlock()
+
+			if changed {
+				log.Println("Обнаружено изменение конфигурации, перезагрузка...")
+				if err := cr.Reload(); err != nil {
+					log.Printf("Ошибка перезагрузки конфигурации: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// currentFingerprint описывает состояние отслеживаемых файлов: основного
+// файла конфигурации, определений опросов, их шаблонов и переводов
+func (cr *ConfigReloader) currentFingerprint() string {
+	paths := []string{cr.path}
+
+	config := cr.sessionManager.currentConfig()
+	if config.SurveysDir != "" {
+		files, _ := filepath.Glob(filepath.Join(config.surveysDir(cr.path), "*"))
+		paths = append(paths, files...)
+	}
+	if config.TranslationsDir != "" {
+		files, _ := filepath.Glob(filepath.Join(resolvePath(cr.path, config.TranslationsDir), "*"))
+		paths = append(paths, files...)
+	}
+	for _, survey := range config.Surveys {
+		if survey.TemplatesDir != "" {
+			files, _ := filepath.Glob(filepath.Join(survey.TemplatesDir, "*.html"))
+			paths = append(paths, files...)
+		}
+	}
+	templates, _ := filepath.Glob("templates/*.html")
+	paths = append(paths, templates...)
+	sort.Strings(paths)
+
+	var b strings.Builder
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(&b, "%s:-;", path)
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// reloadConfig — конфигурация для проверки перезагрузки с портом SMTP и
+// текстом вопроса
+const reloadConfig = `{
+	"smtp_host": "127.0.0.1", "smtp_port": %s,
+	"email": {"to": "a@example.com", "from": "a@example.com"},
+	"questions": [{"id": "name", "text": "%s", "type": "text"}]
+}`
+
+func TestReloadAppliesToNewSessions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	write := func(port, text string) {
+		t.Helper()
+		data := fmt.Sprintf(reloadConfig, port, text)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("1", "Имя")
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewLocalStorage(filepath.Join(dir, "uploads"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := NewSessionManager(config, NewResponseHandler(storage, config.Storage.Prefixes, ""), NewAudioRecorder(storage))
+	reloader := NewConfigReloader(path, sm)
+	started := sm.newSession(sm.currentConfig().Surveys[0])
+
+	write("1", "Как вас зовут?")
+	if reloader.currentFingerprint() == reloader.fingerprint {
+		t.Error("изменение файла конфигурации не обнаружено")
+	}
+	if err := reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := sm.currentConfig().Surveys[0].Questions[0].Text; got != "Как вас зовут?" {
+		t.Errorf("после перезагрузки вопрос «%s»", got)
+	}
+	if got := started.Survey.Questions[0].Text; got != "Имя" {
+		t.Errorf("начатая сессия получила новый вопрос «%s»", got)
+	}
+
+	// Некорректная конфигурация отклоняется, прежняя продолжает действовать
+	write("0", "Другой вопрос")
+	if err := reloader.Reload(); err == nil {
+		t.Error("некорректная конфигурация принята")
+	}
+	if got := sm.currentConfig().Surveys[0].Questions[0].Text; got != "Как вас зовут?" {
+		t.Errorf("после отклоненной перезагрузки вопрос «%s»", got)
+	}
+}
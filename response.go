@@ -1,95 +1,327 @@
 package main
 
 import (
+	"bytes"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
-	"log"
-	"os"
-	"path/filepath"
+	"io"
+	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
-// ResponseHandler управляет сохранением и обработкой ответов
+// ResponseHandler управляет сохранением и обработкой ответов. Все данные
+// сессий записываются в хранилище storage по ключам с префиксами prefixes.
+// Если хранилище шифрующее, к ключам данных сессий добавляется суффикс .age,
+// а служебные данные хранятся открыто в исходном хранилище plain: они не
+// содержат ответов, и сервер сам читает их. Это определения опросов, журнал
+// доставки и журнал аудита. respondentKey — ключ HMAC для хешей
+// идентификаторов респондентов в журнале доставки.
 type ResponseHandler struct {
-	responsesDir string
-	mu           sync.Mutex
+	storage       Storage
+	plain         Storage
+	prefixes      StoragePrefixes
+	suffix        string
+	respondentKey string
+	mu            sync.Mutex
 }
 
 // NewResponseHandler создает новый обработчик ответов
-func NewResponseHandler() *ResponseHandler {
-	// Создаем директорию для ответов, если она не существует
-	responsesDir := "uploads/responses"
-	if err := os.MkdirAll(responsesDir, 0755); err != nil {
-		log.Fatalf("Не удалось создать директорию для ответов: %v", err)
+func NewResponseHandler(storage Storage, prefixes StoragePrefixes, respondentKey string) *ResponseHandler {
+	rh := &ResponseHandler{
+		storage:       storage,
+		plain:         storage,
+		prefixes:      prefixes.resolved(),
+		respondentKey: respondentKey,
+		mu:            sync.Mutex{},
 	}
-
-	return &ResponseHandler{
-		responsesDir: responsesDir,
-		mu:           sync.Mutex{},
+	if encrypted, ok := storage.(*EncryptedStorage); ok {
+		rh.plain = encrypted.Storage
+		rh.suffix = encryptedSuffix
 	}
+	return rh
+}
+
+// Encrypted сообщает, шифруются ли данные сессий
+func (rh *ResponseHandler) Encrypted() bool {
+	return rh.suffix != ""
+}
+
+// key формирует ключ объекта с данными сессии
+func (rh *ResponseHandler) key(prefix string, name ...string) string {
+	return storageKey(prefix, name...) + rh.suffix
 }
 
-// SaveResponses сохраняет ответы пользователя в CSV файл
-func (rh *ResponseHandler) SaveResponses(sessionID string, responses map[string][]string, 
-	questions []QuestionData) error {
+// SaveResponses сохраняет ответы пользователя во всех включенных форматах:
+// CSV, JSON и XLSX файлы сессии и строку в журнале JSONL опроса
+func (rh *ResponseHandler) SaveResponses(session *Session, export ExportConfig) error {
 	rh.mu.Lock()
 	defer rh.mu.Unlock()
 
-	// Формируем имя файла
-	fileName := fmt.Sprintf("responses_%s.csv", sessionID)
-	filePath := filepath.Join(rh.responsesDir, fileName)
+	submitted := session.SubmitTime
+	if submitted.IsZero() {
+		submitted = time.Now()
+	}
+	if export.enabled(ExportFormatCSV) {
+		if err := rh.saveCSV(session, export, submitted); err != nil {
+			return err
+		}
+	}
 
-	// Создаем файл
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("не удалось создать файл %s: %w", filePath, err)
+	record := newSessionRecord(session, submitted)
+	if export.enabled(ExportFormatJSON) {
+		if err := rh.saveJSON(session, record); err != nil {
+			return err
+		}
+	}
+	if export.enabled(ExportFormatJSONL) {
+		if err := rh.appendJSONL(session, record); err != nil {
+			return err
+		}
+	}
+	if export.enabled(ExportFormatXLSX) {
+		if err := rh.saveXLSX(session, record, export); err != nil {
+			return err
+		}
 	}
-	defer file.Close()
+
+	// Сводный набор данных ведется всегда: одна строка на сессию
+	return rh.appendDataset(session, record, export)
+}
+
+// saveCSV сохраняет ответы сессии в CSV файл
+func (rh *ResponseHandler) saveCSV(session *Session, export ExportConfig, submitted time.Time) error {
+	survey := session.Survey
+	// Порядок показа выгружается, только если он отличается от порядка в конфигурации
+	withOrder := survey.randomized()
 
 	// Создаем CSV писателя
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
 
 	// Записываем заголовок
-	header := []string{"Вопрос ID", "Текст вопроса", "Тип вопроса", "Ответ", "Время ответа"}
+	header := []string{"Вопрос ID", "Текст вопроса", "Тип вопроса", "Ответ", "Время ответа", "Версия опроса", "Язык",
+		"Первый ответ", "Время на вопрос, с", "Длительность сессии, с"}
+	if export.OptionFormat == OptionFormatBoth {
+		header = append(header, "Подпись ответа")
+	}
+	if withOrder {
+		header = append(header, "Позиция вопроса", "Порядок вариантов")
+	}
 	if err := writer.Write(header); err != nil {
 		return fmt.Errorf("ошибка записи заголовка CSV: %w", err)
 	}
 
-	// Получаем текущее время
-	timestamp := time.Now().Format(time.RFC3339)
+	duration := strconv.FormatFloat(submitted.Sub(session.StartTime).Seconds(), 'f', 0, 64)
 
 	// Записываем ответы
-	for _, q := range questions {
-		answerValues := responses[q.ID]
-		answer := strings.Join(answerValues, "; ")
-
-		record := []string{
-			q.ID,
-			q.Text,
-			string(q.Type),
-			answer,
-			timestamp,
+	positions := make(map[string]int, len(session.QuestionOrder))
+	for i, id := range session.QuestionOrder {
+		positions[id] = i + 1
+	}
+
+	// Текст вопросов выгружается с подставленными ответами, как его видел
+	// респондент, но на основном языке опроса, чтобы выгрузки сессий на разных
+	// языках можно было объединять; язык респондента указывается отдельно
+	answers := pipedAnswers(survey.Questions, session.Responses)
+
+	for _, q := range survey.Questions {
+		q = pipeQuestion(q, answers)
+		// Время ответа — последнее изменение ответа по данным браузера, а без
+		// них время отправки
+		timing, timed := session.Timings[q.ID]
+		answered, first, dwell := submitted.Format(time.RFC3339), "", ""
+		if !timing.LastAnswer.IsZero() {
+			answered = timing.LastAnswer.Format(time.RFC3339)
 		}
+		if !timing.FirstAnswer.IsZero() {
+			first = timing.FirstAnswer.Format(time.RFC3339)
+		}
+		if timed {
+			dwell = strconv.FormatFloat(timing.Dwell.Seconds(), 'f', 1, 64)
+		}
+		for _, item := range exportItems(q, session.Responses) {
+			answer := strings.Join(item.Values, "; ")
+			if export.OptionFormat == OptionFormatLabel {
+				answer = strings.Join(item.Labels, "; ")
+			}
 
-		if err := writer.Write(record); err != nil {
-			return fmt.Errorf("ошибка записи ответа в CSV: %w", err)
+			record := []string{
+				item.ID,
+				item.Text,
+				string(item.Type),
+				answer,
+				answered,
+				session.SurveyVersion,
+				session.Language,
+				first,
+				dwell,
+				duration,
+			}
+			if export.OptionFormat == OptionFormatBoth {
+				record = append(record, strings.Join(item.Labels, "; "))
+			}
+			if withOrder {
+				record = append(record, strconv.Itoa(positions[q.ID]), strings.Join(session.OptionOrder[q.ID], "; "))
+			}
+
+			if err := writer.Write(record); err != nil {
+				return fmt.Errorf("ошибка записи ответа в CSV: %w", err)
+			}
 		}
 	}
 
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("ошибка записи ответа в CSV: %w", err)
+	}
+	return rh.storage.Put(rh.responseKey(session, ExportFormatCSV), &buf)
+}
+
+// saveJSON сохраняет запись сессии в JSON файл
+func (rh *ResponseHandler) saveJSON(session *Session, record SessionRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка формирования JSON: %w", err)
+	}
+
+	return rh.storage.Put(rh.responseKey(session, ExportFormatJSON), bytes.NewReader(append(data, '\n')))
+}
+
+// appendJSONL дописывает запись сессии строкой в журнал ответов опроса.
+// Журнал только дополняется, поэтому в нем сохраняются все отправки.
+func (rh *ResponseHandler) appendJSONL(session *Session, record SessionRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("ошибка формирования JSON: %w", err)
+	}
+
+	key := rh.logKey(session.Survey.ID)
+	if err := rh.storage.Append(key, append(data, '\n')); err != nil {
+		return fmt.Errorf("ошибка записи в журнал %s: %w", key, err)
+	}
 	return nil
 }
 
-// GetResponseFile возвращает путь к файлу с ответами для сессии
-func (rh *ResponseHandler) GetResponseFile(sessionID string) (string, error) {
-	fileName := fmt.Sprintf("responses_%s.csv", sessionID)
-	filePath := filepath.Join(rh.responsesDir, fileName)
+// saveXLSX сохраняет ответы сессии в книгу Excel с кодификатором и листом
+// сессии
+func (rh *ResponseHandler) saveXLSX(session *Session, record SessionRecord, export ExportConfig) error {
+	columns := datasetColumns(session.Survey.Questions, export.OptionFormat)
+	dataset := surveyDataset{
+		Survey: session.Survey,
+		Header: datasetHeader(columns),
+		Rows:   [][]string{datasetRow(columns, session, record)},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteXLSX(&buf, responsesWorkbook([]surveyDataset{dataset}, export.OptionFormat)); err != nil {
+		return err
+	}
+	return rh.storage.Put(rh.responseKey(session, ExportFormatXLSX), &buf)
+}
+
+// responseKey формирует ключ файла с ответами сессии в формате format
+func (rh *ResponseHandler) responseKey(session *Session, format string) string {
+	return rh.key(rh.prefixes.Responses, fmt.Sprintf("responses_%s_%s.%s", session.Survey.ID, session.ID, format))
+}
+
+// logKey формирует ключ журнала JSONL с ответами опроса
+func (rh *ResponseHandler) logKey(surveyID string) string {
+	return rh.key(rh.prefixes.Responses, fmt.Sprintf("responses_%s.jsonl", surveyID))
+}
+
+// AudioKey формирует ключ аудиозаписи сессии
+func (rh *ResponseHandler) AudioKey(session *Session) string {
+	return rh.key(rh.prefixes.Audio, fmt.Sprintf("audio_%s_%s.wav", session.Survey.ID, session.ID))
+}
+
+// ArchiveKey формирует ключ архива результатов сессии
+func (rh *ResponseHandler) ArchiveKey(session *Session) string {
+	return rh.key(rh.prefixes.Archives, fmt.Sprintf("results_%s_%s.zip", session.Survey.ID, session.ID))
+}
+
+// archiveContents описывает для текста письма файлы архива результатов с
+// ключами keys: ответы в сохраненных форматах, аудиозапись, загруженные
+// респондентом файлы и определение версии опроса (ключ definition)
+func (rh *ResponseHandler) archiveContents(keys []string, definition string) []string {
+	var formats []string
+	var audio bool
+	var uploads int
+	for _, key := range keys {
+		name := strings.TrimSuffix(path.Base(key), rh.suffix)
+		switch {
+		case key == definition:
+		case strings.HasPrefix(key, rh.prefixes.Files+"/"):
+			uploads++
+		case strings.HasPrefix(name, "audio_"):
+			audio = true
+		case strings.HasPrefix(name, "responses_"):
+			switch format := strings.TrimPrefix(path.Ext(name), "."); format {
+			case ExportFormatXLSX:
+				formats = append(formats, "Excel")
+			default:
+				formats = append(formats, strings.ToUpper(format))
+			}
+		}
+	}
+
+	var contents []string
+	if len(formats) > 0 {
+		contents = append(contents, "Ответы пользователя в форматах "+strings.Join(formats, ", "))
+	}
+	if audio {
+		contents = append(contents, "Аудиозапись, сделанная во время прохождения опроса")
+	}
+	if uploads > 0 {
+		contents = append(contents, fmt.Sprintf("Файлы, загруженные пользователем: %d", uploads))
+	}
+	if definition != "" && contains(keys, definition) {
+		contents = append(contents, "Определение версии опроса с текстом вопросов")
+	}
+	return contents
+}
+
+// GetResponseFiles возвращает ключи сохраненных файлов с ответами сессии
+// (CSV, JSON и XLSX в зависимости от настроек выгрузки)
+func (rh *ResponseHandler) GetResponseFiles(session *Session) ([]string, error) {
+	var keys []string
+	for _, format := range []string{ExportFormatCSV, ExportFormatJSON, ExportFormatXLSX} {
+		key := rh.responseKey(session, format)
+		exists, err := rh.storage.Exists(key)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("файлы с ответами сессии %s не найдены", session.ID)
+	}
+	return keys, nil
+}
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return "", fmt.Errorf("файл с ответами не найден: %w", err)
+// SaveUpload сохраняет загруженный респондентом файл рядом с другими файлами
+// сессии и возвращает ключ сохраненного файла
+func (rh *ResponseHandler) SaveUpload(sessionID, fileName string, src io.Reader) (string, error) {
+	key := rh.key(rh.prefixes.Files, sessionID, sanitizeFileName(fileName))
+	if err := rh.storage.Put(key, src); err != nil {
+		return "", err
 	}
+	return key, nil
+}
+
+// ArchiveSurvey сохраняет определение версии опроса в архив версий
+// хранилища и возвращает его ключ
+func (rh *ResponseHandler) ArchiveSurvey(survey *Survey) (string, error) {
+	return ArchiveSurvey(rh.plain, rh.prefixes.Versions, survey)
+}
 
-	return filePath, nil
+// LoadSurveyVersion загружает определение версии опроса из архива версий
+func (rh *ResponseHandler) LoadSurveyVersion(surveyID, version string) (*Survey, error) {
+	return LoadSurveyVersion(rh.plain, rh.prefixes.Versions, surveyID, version)
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveResponsesJSONAndJSONL(t *testing.T) {
+	sm := newTestManager(t, `{
+		"smtp_host": "127.0.0.1", "smtp_port": 1,
+		"email": {"to": "a@example.com", "from": "a@example.com"},
+		"export": {"formats": ["json", "jsonl"]},
+		"questions": [
+			{"id": "fruit", "text": "Фрукты", "type": "multi_choice", "options": [{"value": "a", "label": "Яблоко; зеленое"}, "Груша"]},
+			{"id": "age", "text": "Возраст", "type": "number"}
+		]
+	}`)
+	rh := sm.responseHandler
+	survey := sm.currentConfig().Surveys[0]
+	submitted := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+
+	var ids []string
+	for _, answer := range []struct {
+		fruits []string
+		age    float64
+	}{{[]string{"a", "Груша"}, 3}, {[]string{"Груша"}, 30}} {
+		session := sm.newSession(survey)
+		session.StartTime = submitted.Add(-time.Minute)
+		session.SubmitTime = submitted
+		session.Responses = map[string][]string{"fruit": answer.fruits, "age": {fmt.Sprint(answer.age)}}
+		session.Typed = map[string]interface{}{"age": answer.age}
+		if err := rh.SaveResponses(session, sm.currentConfig().Export); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, session.ID)
+
+		if exists, _ := rh.storage.Exists(rh.responseKey(session, ExportFormatCSV)); exists {
+			t.Error("сохранен CSV, не включенный в форматы выгрузки")
+		}
+	}
+
+	var record SessionRecord
+	first := &Session{ID: ids[0], Survey: survey}
+	if err := json.Unmarshal([]byte(readObject(t, rh.storage, rh.responseKey(first, ExportFormatJSON))), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.SessionID != ids[0] || record.DurationSeconds != 60 || len(record.Answers) != 2 {
+		t.Fatalf("запись сессии %+v", record)
+	}
+	fruit, age := record.Answers[0], record.Answers[1]
+	if !reflect.DeepEqual(fruit.Values, []string{"a", "Груша"}) || !reflect.DeepEqual(fruit.Labels, []string{"Яблоко; зеленое", "Груша"}) {
+		t.Errorf("ответ с вариантами %+v", fruit)
+	}
+	if age.Value != 3.0 {
+		t.Errorf("числовое значение %v (%T)", age.Value, age.Value)
+	}
+
+	lines := strings.Split(strings.TrimSpace(readObject(t, rh.storage, rh.logKey(survey.ID))), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("в журнале JSONL %d строк, ожидалось 2", len(lines))
+	}
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &record); err != nil || record.SessionID != ids[i] {
+			t.Errorf("строка %d журнала: %v, %s", i+1, err, line)
+		}
+	}
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// defaultRetentionInterval — период проверки журнала доставки по умолчанию
+const defaultRetentionInterval = time.Hour
+
+// defaultMaxAttempts — число попыток отправки по умолчанию
+const defaultMaxAttempts = 10
+
+// maxRetryDelay ограничивает паузу между повторами отправки
+const maxRetryDelay = 24 * time.Hour
+
+// RetentionConfig задает срок хранения файлов сессий после отправки
+type RetentionConfig struct {
+	// DeliveredDays — через сколько дней после успешной отправки удаляются
+	// файлы сессии; 0 — файлы хранятся бессрочно
+	DeliveredDays int `json:"delivered_days,omitempty"`
+	// IntervalMinutes — период проверки журнала доставки: повтора неудачных
+	// отправок и удаления файлов с истекшим сроком (60 по умолчанию)
+	IntervalMinutes int `json:"interval_minutes,omitempty"`
+	// MaxAttempts — число попыток отправки, после которого доставка
+	// прекращается (10 по умолчанию)
+	MaxAttempts int `json:"max_attempts,omitempty"`
+}
+
+// interval возвращает период проверки журнала доставки
+func (c RetentionConfig) interval() time.Duration {
+	if c.IntervalMinutes <= 0 {
+		return defaultRetentionInterval
+	}
+	return time.Duration(c.IntervalMinutes) * time.Minute
+}
+
+// maxAttempts возвращает число попыток отправки
+func (c RetentionConfig) maxAttempts() int {
+	if c.MaxAttempts <= 0 {
+		return defaultMaxAttempts
+	}
+	return c.MaxAttempts
+}
+
+// retryDelay возвращает паузу перед повтором после attempts неудачных
+// попыток: период проверки удваивается с каждой попыткой, но пауза не
+// превышает суток
+func (c RetentionConfig) retryDelay(attempts int) time.Duration {
+	delay := c.interval()
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// Состояния доставки результатов сессии. Отправка, не удавшаяся за
+// retention.max_attempts попыток, переходит в состояние abandoned и больше
+// не повторяется; ее можно повторить вручную через /admin/deliveries.
+const (
+	DeliveryPending   = "pending"
+	DeliveryFailed    = "failed"
+	DeliveryAbandoned = "abandoned"
+	DeliveryDelivered = "delivered"
+	DeliveryPurged    = "purged"
+)
+
+// deliveryStatuses перечисляет состояния доставки
+var deliveryStatuses = []string{DeliveryPending, DeliveryFailed, DeliveryAbandoned, DeliveryDelivered, DeliveryPurged}
+
+// Delivery — запись журнала доставки результатов сессии. Журнал хранится
+// вне памяти сервера, поэтому неудачные отправки повторяются и после
+// перезапуска, а файлы доставленных сессий удаляются по истечении срока.
+type Delivery struct {
+	SessionID     string `json:"session_id"`
+	SurveyID      string `json:"survey_id"`
+	SurveyVersion string `json:"survey_version"`
+	Language      string `json:"language"`
+	// Respondents — HMAC идентификаторов респондента из его ответов (email
+	// и телефонов), по которым находятся данные для запросов респондента.
+	// Журнал доставки не шифруется, поэтому при шифровании хранилища или без
+	// ключа respondent_key хеши не записываются.
+	Respondents []string `json:"respondents,omitempty"`
+	// Files — ключи файлов сессии, которые входят в архив и удаляются по
+	// истечении срока хранения; Archive — ключ архива результатов
+	Files   []string `json:"files"`
+	Archive string   `json:"archive"`
+	// Definition — ключ определения версии опроса, которое добавляется в
+	// архив; оно общее для всех сессий версии и не удаляется
+	Definition  string     `json:"definition,omitempty"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	SubmittedAt time.Time  `json:"submitted_at"`
+	LastAttempt time.Time  `json:"last_attempt"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	PurgedAt    *time.Time `json:"purged_at,omitempty"`
+	// Error — ошибка последней неудачной попытки
+	Error string `json:"error,omitempty"`
+}
+
+// Действия в журнале аудита
+const (
+	AuditDelete = "delete"
+	AuditRedact = "redact"
+)
+
+// AuditEntry — запись журнала аудита об удалении файла или строк из него
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Key       string    `json:"key"`
+	SessionID string    `json:"session_id,omitempty"`
+	Reason    string    `json:"reason"`
+}
+
+// deliveryKey формирует ключ записи журнала доставки сессии
+func (rh *ResponseHandler) deliveryKey(sessionID string) string {
+	return storageKey(rh.prefixes.Deliveries, fmt.Sprintf("delivery_%s.json", sessionID))
+}
+
+// auditKey — ключ журнала аудита
+func (rh *ResponseHandler) auditKey() string {
+	return storageKey(rh.prefixes.Audit, "audit.jsonl")
+}
+
+// SaveDelivery сохраняет запись журнала доставки
+func (rh *ResponseHandler) SaveDelivery(delivery *Delivery) error {
+	data, err := json.MarshalIndent(delivery, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка формирования записи доставки: %w", err)
+	}
+	key := rh.deliveryKey(delivery.SessionID)
+	if err := rh.plain.Put(key, bytes.NewReader(append(data, '\n'))); err != nil {
+		return fmt.Errorf("не удалось сохранить запись доставки %s: %w", key, err)
+	}
+	return nil
+}
+
+// Deliveries читает все записи журнала доставки
+func (rh *ResponseHandler) Deliveries() ([]*Delivery, error) {
+	keys, err := rh.plain.List(rh.prefixes.Deliveries + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*Delivery, 0, len(keys))
+	for _, key := range keys {
+		if path.Ext(key) != ".json" {
+			continue
+		}
+		delivery, err := rh.loadDelivery(key)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// loadDelivery читает запись журнала доставки по ключу
+func (rh *ResponseHandler) loadDelivery(key string) (*Delivery, error) {
+	body, err := rh.plain.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть запись доставки %s: %w", key, err)
+	}
+	defer body.Close()
+
+	var delivery Delivery
+	if err := json.NewDecoder(body).Decode(&delivery); err != nil {
+		return nil, fmt.Errorf("ошибка чтения записи доставки %s: %w", key, err)
+	}
+	return &delivery, nil
+}
+
+// deleteFile безвозвратно удаляет объект хранилища и записывает удаление в
+// журнал аудита. Без записи в журнале удаление считается незавершенным.
+func (rh *ResponseHandler) deleteFile(key, sessionID, reason string) error {
+	if err := shredObject(rh.storage, key); err != nil {
+		return err
+	}
+	if err := rh.audit(AuditDelete, key, sessionID, reason); err != nil {
+		return err
+	}
+	log.Printf("Удален файл %s сессии %s: %s", key, sessionID, reason)
+	return nil
+}
+
+// audit дописывает запись в журнал аудита
+func (rh *ResponseHandler) audit(action, key, sessionID, reason string) error {
+	entry := AuditEntry{Time: time.Now().UTC(), Action: action, Key: key, SessionID: sessionID, Reason: reason}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("ошибка формирования записи аудита: %w", err)
+	}
+	if err := rh.plain.Append(rh.auditKey(), append(data, '\n')); err != nil {
+		return fmt.Errorf("не удалось записать %s %s в журнал аудита: %w", action, key, err)
+	}
+	return nil
+}
+
+// PurgeDelivery удаляет файлы и архив доставленной сессии. Запись журнала
+// доставки сохраняется с отметкой об удалении.
+func (rh *ResponseHandler) PurgeDelivery(delivery *Delivery, reason string) error {
+	for _, key := range append(append([]string{}, delivery.Files...), delivery.Archive) {
+		if err := rh.deleteFile(key, delivery.SessionID, reason); err != nil {
+			return err
+		}
+	}
+	delivery.Status = DeliveryPurged
+	delivery.PurgedAt = timePointer(time.Now().UTC())
+	return rh.SaveDelivery(delivery)
+}
+
+// abandonDelivery прекращает повторы отправки, исчерпавшей попытки. Файлы
+// сессии сохраняются до ручного повтора или удаления по запросу респондента.
+func (rh *ResponseHandler) abandonDelivery(delivery *Delivery) {
+	delivery.Status = DeliveryAbandoned
+	log.Printf("Отправка результатов сессии %s прекращена после %d попыток: %s", delivery.SessionID, delivery.Attempts, delivery.Error)
+	if err := rh.SaveDelivery(delivery); err != nil {
+		log.Printf("Ошибка записи журнала доставки: %v", err)
+	}
+}
+
+// RunRetention обслуживает журнал доставки: сразу и затем с периодом из
+// настроек повторяет неудачные отправки и удаляет файлы сессий, срок
+// хранения которых истек. Работает до закрытия stop.
+func (sm *SessionManager) RunRetention(stop <-chan struct{}) {
+	for {
+		sm.processDeliveries(time.Now())
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(sm.currentConfig().Retention.interval()):
+		}
+	}
+}
+
+// processDeliveries выполняет один проход по журналу доставки
+func (sm *SessionManager) processDeliveries(now time.Time) {
+	retention := sm.currentConfig().Retention
+	deliveries, err := sm.responseHandler.Deliveries()
+	if err != nil {
+		log.Printf("Ошибка чтения журнала доставки: %v", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		switch delivery.Status {
+		case DeliveryPending, DeliveryFailed:
+			// Отправка, начатая меньше периода назад, может еще выполняться;
+			// после неудачных попыток пауза перед повтором растет
+			wait := retention.interval()
+			if delivery.Status == DeliveryFailed {
+				// Число попыток могли уменьшить в настройках после неудачи
+				if delivery.Attempts >= retention.maxAttempts() {
+					sm.responseHandler.abandonDelivery(delivery)
+					continue
+				}
+				wait = retention.retryDelay(delivery.Attempts)
+			}
+			if now.Sub(delivery.LastAttempt) < wait {
+				continue
+			}
+			if err := sm.retryDelivery(delivery); err != nil {
+				log.Printf("Повторная отправка результатов сессии %s не удалась: %v", delivery.SessionID, err)
+			}
+		case DeliveryDelivered:
+			if retention.DeliveredDays <= 0 || delivery.DeliveredAt == nil {
+				continue
+			}
+			if now.Before(delivery.DeliveredAt.AddDate(0, 0, retention.DeliveredDays)) {
+				continue
+			}
+			reason := fmt.Sprintf("срок хранения %d дн. после отправки истек", retention.DeliveredDays)
+			if err := sm.responseHandler.PurgeDelivery(delivery, reason); err != nil {
+				log.Printf("Ошибка удаления файлов сессии %s: %v", delivery.SessionID, err)
+			}
+		}
+	}
+}
+
+// retryDelivery повторяет отправку результатов сессии из журнала доставки.
+// Сессия к этому времени может отсутствовать в памяти, поэтому письмо
+// формируется по записи журнала и архивному определению версии опроса, на
+// которую отвечал респондент. Настройки email берутся из текущей
+// конфигурации: в архиве версий нет пароля архива, а адреса могли исправить
+// после неудачной отправки.
+func (sm *SessionManager) retryDelivery(delivery *Delivery) error {
+	survey, err := sm.responseHandler.LoadSurveyVersion(delivery.SurveyID, delivery.SurveyVersion)
+	if err != nil {
+		delivery.LastAttempt = time.Now().UTC()
+		err = fmt.Errorf("определение версии %s опроса %s не найдено в архиве версий: %w", delivery.SurveyVersion, delivery.SurveyID, err)
+		return sm.recordAttempt(delivery, err)
+	}
+	if current, ok := sm.currentConfig().Survey(delivery.SurveyID); ok {
+		survey.Email = current.Email
+	}
+	session := &Session{
+		ID:            delivery.SessionID,
+		Survey:        survey,
+		SurveyVersion: delivery.SurveyVersion,
+		Language:      delivery.Language,
+		SubmitTime:    delivery.SubmittedAt,
+	}
+	return sm.deliver(delivery, session)
+}
+
+// HandleDeliveries показывает журнал доставки и повторяет отправку вручную:
+//
+//	GET  /admin/deliveries?status=<состояние>        — записи журнала в JSON
+//	POST /admin/deliveries/retry?session_id=<id>     — повтор отправки
+//
+// Повтор начинает отсчет попыток заново, поэтому после исправления настроек
+// им возобновляется и отправка в состоянии abandoned.
+func (sm *SessionManager) HandleDeliveries(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r, sm.currentConfig()) {
+		return
+	}
+
+	action := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin/deliveries"), "/")
+	method := http.MethodGet
+	if action == "retry" {
+		method = http.MethodPost
+	}
+	if action != "" && action != "retry" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if action == "" {
+		status := r.FormValue("status")
+		if status != "" && !contains(deliveryStatuses, status) {
+			http.Error(w, "Неизвестное состояние: допустимы "+strings.Join(deliveryStatuses, ", "), http.StatusBadRequest)
+			return
+		}
+		deliveries, err := sm.responseHandler.Deliveries()
+		if err != nil {
+			log.Printf("Ошибка чтения журнала доставки: %v", err)
+			http.Error(w, "Ошибка чтения журнала доставки", http.StatusInternalServerError)
+			return
+		}
+		found := []*Delivery{}
+		for _, delivery := range deliveries {
+			if status == "" || delivery.Status == status {
+				found = append(found, delivery)
+			}
+		}
+		writeJSON(w, found)
+		return
+	}
+
+	sessionID := r.FormValue("session_id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		http.Error(w, "Некорректный ID сессии", http.StatusBadRequest)
+		return
+	}
+	delivery, err := sm.responseHandler.loadDelivery(sm.responseHandler.deliveryKey(sessionID))
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "Запись доставки не найдена", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка чтения журнала доставки: %v", err)
+		http.Error(w, "Ошибка чтения журнала доставки", http.StatusInternalServerError)
+		return
+	}
+	if delivery.Status != DeliveryFailed && delivery.Status != DeliveryAbandoned {
+		http.Error(w, "Повторить можно только неудавшуюся отправку", http.StatusConflict)
+		return
+	}
+
+	delivery.Attempts = 0
+	if err := sm.retryDelivery(delivery); err != nil {
+		log.Printf("Повторная отправка результатов сессии %s не удалась: %v", sessionID, err)
+		http.Error(w, fmt.Sprintf("Повторная отправка не удалась: %v", err), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, delivery)
+}
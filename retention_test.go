@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRetryDelay(t *testing.T) {
+	retention := RetentionConfig{IntervalMinutes: 30}
+	for attempts, want := range map[int]time.Duration{
+		1:  30 * time.Minute,
+		2:  time.Hour,
+		4:  4 * time.Hour,
+		10: maxRetryDelay,
+	} {
+		if got := retention.retryDelay(attempts); got != want {
+			t.Errorf("пауза после %d попыток %v, ожидалось %v", attempts, got, want)
+		}
+	}
+}
+
+func TestFailedDeliveryIsAbandoned(t *testing.T) {
+	sm := newTestManager(t, `{
+		"smtp_host": "127.0.0.1", "smtp_port": 1,
+		"admin_token": "secret",
+		"email": {"to": "a@example.com", "from": "a@example.com"},
+		"retention": {"interval_minutes": 60, "max_attempts": 3},
+		"questions": [{"id": "name", "text": "Имя", "type": "text"}]
+	}`)
+	rh := sm.responseHandler
+	survey := sm.currentConfig().DefaultSurvey()
+	if _, err := rh.ArchiveSurvey(survey); err != nil {
+		t.Fatal(err)
+	}
+	sessionID := uuid.New().String()
+	start := time.Now().UTC()
+	delivery := &Delivery{
+		SessionID: sessionID, SurveyID: survey.ID, SurveyVersion: survey.Version, Status: DeliveryFailed,
+		Attempts: 1, LastAttempt: start.Add(-90 * time.Minute), Archive: "results.zip",
+	}
+	if err := rh.SaveDelivery(delivery); err != nil {
+		t.Fatal(err)
+	}
+	load := func() *Delivery {
+		t.Helper()
+		delivery, err := rh.loadDelivery(rh.deliveryKey(sessionID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return delivery
+	}
+
+	// Пауза после первой попытки — период проверки
+	sm.processDeliveries(start)
+	if got := load(); got.Status != DeliveryFailed || got.Attempts != 2 {
+		t.Fatalf("после повтора %s, попыток %d", got.Status, got.Attempts)
+	}
+	// После второй попытки пауза удваивается
+	sm.processDeliveries(start.Add(90 * time.Minute))
+	if got := load(); got.Attempts != 2 {
+		t.Fatalf("повтор раньше паузы: попыток %d", got.Attempts)
+	}
+	sm.processDeliveries(start.Add(3 * time.Hour))
+	if got := load(); got.Status != DeliveryAbandoned || got.Attempts != 3 {
+		t.Fatalf("после последней попытки %s, попыток %d", got.Status, got.Attempts)
+	}
+	sm.processDeliveries(start.Add(30 * 24 * time.Hour))
+	if got := load(); got.Attempts != 3 {
+		t.Errorf("прекращенная отправка повторена: попыток %d", got.Attempts)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/deliveries?status=abandoned", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	sm.HandleDeliveries(rec, req)
+	var listed []Delivery
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("%v: %s", err, rec.Body.String())
+	}
+	if len(listed) != 1 || listed[0].SessionID != sessionID || listed[0].Error == "" {
+		t.Errorf("список прекращенных отправок: %s", rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/deliveries/retry?session_id="+sessionID, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	sm.HandleDeliveries(rec, req)
+	if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "ошибка отправки email") {
+		t.Errorf("ответ на неудавшийся ручной повтор: %d %s", rec.Code, rec.Body.String())
+	}
+	if got := load(); got.Status != DeliveryFailed || got.Attempts != 1 {
+		t.Errorf("после ручного повтора %s, попыток %d", got.Status, got.Attempts)
+	}
+}
+
+// smtpMessage — письмо, принятое тестовым SMTP-сервером
+type smtpMessage struct {
+	To   []string
+	Data string
+}
+
+// startSMTP запускает SMTP-сервер, который принимает любые письма и
+// передает их в канал. Возвращает порт сервера.
+func startSMTP(t *testing.T) (int, <-chan smtpMessage) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	messages := make(chan smtpMessage, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, messages
+}
+
+// serveSMTP ведет один SMTP-диалог
+func serveSMTP(conn net.Conn, messages chan<- smtpMessage) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+	reply("220 test")
+	var message smtpMessage
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			reply("250-test")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(command, "AUTH"):
+			reply("235 ok")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			message.To = append(message.To, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+			reply("250 ok")
+		case command == "DATA":
+			reply("354 go")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			message.Data = data.String()
+			messages <- message
+			message = smtpMessage{}
+			reply("250 ok")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestRetryUsesArchivedVersionAndSubmitTime(t *testing.T) {
+	port, messages := startSMTP(t)
+	sm := newTestManager(t, fmt.Sprintf(`{
+		"smtp_host": "127.0.0.1", "smtp_port": %d,
+		"admin_token": "secret",
+		"email": {"to": "a@example.com", "from": "a@example.com"},
+		"questions": [{"id": "name", "text": "Имя", "type": "text"}]
+	}`, port))
+	rh := sm.responseHandler
+
+	// Опроса old уже нет в конфигурации, но его версия есть в архиве версий
+	old := &Survey{ID: "old", Version: "v1", Email: EmailConfig{To: "old@example.com", From: "a@example.com"},
+		Questions: []QuestionData{{ID: "name", Text: "Имя", Type: TypeText}}}
+	definition, err := rh.ArchiveSurvey(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rh.storage.Put("responses.json", strings.NewReader("{}")); err != nil {
+		t.Fatal(err)
+	}
+	submitted := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	retry := func(version string) (*httptest.ResponseRecorder, *Delivery) {
+		t.Helper()
+		delivery := &Delivery{
+			SessionID: uuid.New().String(), SurveyID: old.ID, SurveyVersion: version, Status: DeliveryFailed,
+			Files: []string{"responses.json"}, Definition: definition, Archive: "results_" + version + ".zip",
+			SubmittedAt: submitted, Attempts: 1,
+		}
+		if err := rh.SaveDelivery(delivery); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/admin/deliveries/retry?session_id="+delivery.SessionID, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		sm.HandleDeliveries(rec, req)
+		saved, err := rh.loadDelivery(rh.deliveryKey(delivery.SessionID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rec, saved
+	}
+
+	rec, delivery := retry("v1")
+	if rec.Code != http.StatusOK || delivery.Status != DeliveryDelivered {
+		t.Fatalf("повтор по архивной версии: %d %s, запись %s %s", rec.Code, rec.Body.String(), delivery.Status, delivery.Error)
+	}
+	select {
+	case message := <-messages:
+		if len(message.To) != 1 || message.To[0] != "old@example.com" {
+			t.Errorf("получатели %v, ожидался old@example.com", message.To)
+		}
+		parsed, err := mail.ReadMessage(strings.NewReader(message.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := submitted.Local().Format("2006-01-02 15:04"); !strings.HasSuffix(subject, want) {
+			t.Errorf("тема письма %q, ожидалось время отправки ответов %s", subject, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("письмо не получено")
+	}
+
+	// Без архивного определения версии повтор не выполняется, а попытка
+	// засчитывается
+	rec, delivery = retry("v2")
+	if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "v2") {
+		t.Errorf("ответ на повтор без определения версии: %d %s", rec.Code, rec.Body.String())
+	}
+	if delivery.Status != DeliveryFailed || delivery.Attempts != 1 || !strings.Contains(delivery.Error, "архиве версий") {
+		t.Errorf("запись после повтора без определения версии: %s, попыток %d, %q", delivery.Status, delivery.Attempts, delivery.Error)
+	}
+}
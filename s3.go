@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3Config содержит настройки S3-совместимого хранилища: Amazon S3, MinIO
+// и других сервисов с тем же API
+type S3Config struct {
+	// Endpoint — адрес сервиса, например http://localhost:9000 для MinIO.
+	// По умолчанию https://s3.<region>.amazonaws.com.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Region — регион подписи запросов (us-east-1 по умолчанию)
+	Region string `json:"region,omitempty"`
+	Bucket string `json:"bucket,omitempty"`
+	// Prefix — общий префикс всех ключей в бакете
+	Prefix    string `json:"prefix,omitempty"`
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"secret_key,omitempty" secret:"true"`
+	// PathStyle включает адреса вида <endpoint>/<bucket>/<ключ>, которые
+	// нужны MinIO и большинству совместимых сервисов. Без него бакет
+	// указывается в имени хоста, как принято в Amazon S3.
+	PathStyle bool `json:"path_style,omitempty"`
+}
+
+// defaultS3Region используется, если регион не задан
+const defaultS3Region = "us-east-1"
+
+// S3Storage хранит объекты в бакете S3-совместимого сервиса. Запросы
+// подписываются AWS Signature Version 4.
+type S3Storage struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+	// mu упорядочивает дописывание: в S3 нет добавления в конец объекта,
+	// поэтому Append читает объект и записывает его заново
+	mu sync.Mutex
+}
+
+// NewS3Storage создает хранилище S3 по настройкам
+func NewS3Storage(config S3Config) (*S3Storage, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("не задан бакет S3")
+	}
+	if config.Region == "" {
+		config.Region = defaultS3Region
+	}
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("некорректный адрес S3 %s", endpoint)
+	}
+
+	return &S3Storage{
+		config:   config,
+		endpoint: u,
+		client:   &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// objectKey возвращает ключ объекта в бакете с общим префиксом
+func (s *S3Storage) objectKey(key string) string {
+	if prefix := strings.Trim(s.config.Prefix, "/"); prefix != "" {
+		return prefix + "/" + key
+	}
+	return key
+}
+
+// objectURL формирует адрес объекта (или бакета, если ключ пустой)
+func (s *S3Storage) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	p := strings.TrimSuffix(u.Path, "/")
+	if s.config.PathStyle {
+		p += "/" + s.config.Bucket
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+	}
+	if key != "" {
+		p += "/" + key
+	}
+	if p == "" {
+		p = "/"
+	}
+
+	u.Path = p
+	u.RawPath = s3Escape(p, false)
+	u.RawQuery = s3Query(query)
+	return &u
+}
+
+// do выполняет подписанный запрос к объекту key
+func (s *S3Storage) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, "", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.URL = s.objectURL(key, query)
+	req.Host = req.URL.Host
+
+	sum := sha256.Sum256(body)
+	s.sign(req, hex.EncodeToString(sum[:]), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса S3 %s %s: %w", method, key, err)
+	}
+	return resp, nil
+}
+
+// sign добавляет к запросу подпись AWS Signature Version 4. Подписываются
+// адрес, параметры, хеш тела и все заголовки запроса.
+func (s *S3Storage) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretKey), date)
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKey, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 вычисляет HMAC-SHA256 сообщения
+func hmacSHA256(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// s3Escape кодирует строку для адреса и подписи: все символы, кроме
+// букв, цифр и -_.~ (и /, если encodeSlash не установлен), заменяются на %XX
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// s3Query формирует строку параметров в каноническом виде: параметры
+// отсортированы по имени и закодированы s3Escape
+func s3Query(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, s3Escape(name, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Error — тело ответа S3 с ошибкой
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// responseError формирует ошибку по ответу S3 и закрывает его тело.
+// Ответ 404 соответствует os.ErrNotExist.
+func (s *S3Storage) responseError(resp *http.Response, method, key string) error {
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	var e s3Error
+	xml.Unmarshal(data, &e)
+	message := resp.Status
+	if e.Code != "" {
+		message += " " + e.Code
+	}
+	if e.Message != "" {
+		message += ": " + e.Message
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("S3 %s %s: %s: %w", method, key, message, os.ErrNotExist)
+	}
+	return fmt.Errorf("S3 %s %s: %s", method, key, message)
+}
+
+// Put загружает объект. Тело читается целиком, потому что его хеш входит
+// в подпись запроса.
+func (s *S3Storage) Put(key string, r io.Reader) error {
+	if !validStorageKey(key) {
+		return fmt.Errorf("недопустимый ключ хранилища %q", key)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения данных для %s: %w", key, err)
+	}
+	return s.put(key, body)
+}
+
+// put загружает объект из памяти
+func (s *S3Storage) put(key string, body []byte) error {
+	resp, err := s.do(http.MethodPut, s.objectKey(key), nil, body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return s.responseError(resp, http.MethodPut, key)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get открывает объект для чтения
+func (s *S3Storage) Get(key string) (io.ReadCloser, error) {
+	if !validStorageKey(key) {
+		return nil, fmt.Errorf("недопустимый ключ хранилища %q", key)
+	}
+	resp, err := s.do(http.MethodGet, s.objectKey(key), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, s.responseError(resp, http.MethodGet, key)
+	}
+	return resp.Body, nil
+}
+
+// Append дописывает данные к объекту. Чтение и запись объекта не атомарны
+// для нескольких экземпляров приложения, использующих один бакет.
+func (s *S3Storage) Append(key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var content []byte
+	body, err := s.Get(key)
+	switch {
+	case err == nil:
+		content, err = io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return fmt.Errorf("ошибка чтения объекта %s: %w", key, err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+	return s.put(key, append(content, data...))
+}
+
+// Exists проверяет наличие объекта запросом HEAD
+func (s *S3Storage) Exists(key string) (bool, error) {
+	if !validStorageKey(key) {
+		return false, fmt.Errorf("недопустимый ключ хранилища %q", key)
+	}
+	resp, err := s.do(http.MethodHead, s.objectKey(key), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("S3 HEAD %s: %s", key, resp.Status)
+	}
+}
+
+// Delete удаляет объект
+func (s *S3Storage) Delete(key string) error {
+	if !validStorageKey(key) {
+		return fmt.Errorf("недопустимый ключ хранилища %q", key)
+	}
+	resp, err := s.do(http.MethodDelete, s.objectKey(key), nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s.responseError(resp, http.MethodDelete, key)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3ListResult — страница ответа ListObjectsV2
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List перебирает страницы ListObjectsV2 и возвращает ключи без общего префикса
+func (s *S3Storage) List(prefix string) ([]string, error) {
+	root := s.objectKey("")
+	query := url.Values{"list-type": {"2"}, "prefix": {root + prefix}}
+
+	var keys []string
+	for {
+		resp, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, s.responseError(resp, http.MethodGet, prefix)
+		}
+
+		var page s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("ошибка разбора списка объектов S3: %w", err)
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, strings.TrimPrefix(object.Key, root))
+		}
+
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
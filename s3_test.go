@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 — сервер с подмножеством API S3 для проверки S3Storage без MinIO:
+// объекты в памяти, адреса в стиле path, проверка подписи SigV4 и
+// постраничный ListObjectsV2
+type fakeS3 struct {
+	t         *testing.T
+	bucket    string
+	accessKey string
+	secretKey string
+	region    string
+	// pageSize — число ключей на странице списка
+	pageSize int
+	// forbidden — запросы с неверной подписью ожидаются тестом и не
+	// считаются ошибкой
+	forbidden bool
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	// paths — пути запросов к объектам в том виде, в каком они получены
+	paths []string
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{
+		t:         t,
+		bucket:    "results",
+		accessKey: "AKIDEXAMPLE",
+		secretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		region:    "eu-central-1",
+		pageSize:  2,
+		objects:   make(map[string][]byte),
+	}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+// storage возвращает S3Storage, подключенное к серверу
+func (f *fakeS3) storage(t *testing.T, server *httptest.Server, prefix string) *S3Storage {
+	storage, err := NewS3Storage(S3Config{
+		Endpoint:  server.URL,
+		Region:    f.region,
+		Bucket:    f.bucket,
+		Prefix:    prefix,
+		AccessKey: f.accessKey,
+		SecretKey: f.secretKey,
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage
+}
+
+// s3Fail отвечает ошибкой в формате S3
+func s3Fail(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if problem := f.checkSignature(r, body); problem != "" {
+		if !f.forbidden {
+			f.t.Errorf("%s %s: %s", r.Method, r.RequestURI, problem)
+		}
+		s3Fail(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	rawPath := strings.SplitN(r.RequestURI, "?", 2)[0]
+	bucketPath := "/" + f.bucket
+	if rawPath == bucketPath || rawPath == bucketPath+"/" {
+		f.list(w, r)
+		return
+	}
+	if !strings.HasPrefix(rawPath, bucketPath+"/") {
+		s3Fail(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, bucketPath+"/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paths = append(f.paths, rawPath)
+	data, exists := f.objects[key]
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[key] = body
+	case http.MethodGet, http.MethodHead:
+		if !exists {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			s3Fail(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Fail(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// list отвечает на ListObjectsV2 страницами по pageSize ключей
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("list-type") != "2" {
+		s3Fail(w, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+
+	f.mu.Lock()
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, query.Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	f.mu.Unlock()
+	sort.Strings(keys)
+
+	start := 0
+	if token := query.Get("continuation-token"); token != "" {
+		fmt.Sscan(token, &start)
+	}
+	type object struct {
+		Key string `xml:"Key"`
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []object `xml:"Contents"`
+		IsTruncated           bool     `xml:"IsTruncated"`
+		NextContinuationToken string   `xml:"NextContinuationToken,omitempty"`
+	}{}
+	for i := start; i < len(keys) && i < start+f.pageSize; i++ {
+		result.Contents = append(result.Contents, object{keys[i]})
+	}
+	if start+f.pageSize < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = fmt.Sprint(start + f.pageSize)
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// checkSignature независимо от S3Storage вычисляет подпись SigV4 запроса и
+// возвращает описание расхождения или пустую строку
+func (f *fakeS3) checkSignature(r *http.Request, body []byte) string {
+	amzDate := r.Header.Get("X-Amz-Date")
+	stamp, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil {
+		return "некорректный X-Amz-Date " + amzDate
+	}
+	if d := time.Since(stamp); d > time.Minute || d < -time.Minute {
+		return "X-Amz-Date не совпадает с текущим временем"
+	}
+	sum := sha256.Sum256(body)
+	if got := r.Header.Get("X-Amz-Content-Sha256"); got != hex.EncodeToString(sum[:]) {
+		return "X-Amz-Content-Sha256 не совпадает с хешем тела"
+	}
+
+	var credential, signedHeaders, signature string
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+		return "неизвестная схема подписи: " + auth
+	}
+	for _, part := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ", ") {
+		name, value, _ := strings.Cut(part, "=")
+		switch name {
+		case "Credential":
+			credential = value
+		case "SignedHeaders":
+			signedHeaders = value
+		case "Signature":
+			signature = value
+		}
+	}
+	scope := amzDate[:8] + "/" + f.region + "/s3/aws4_request"
+	if credential != f.accessKey+"/"+scope {
+		return "некорректный Credential " + credential
+	}
+	for _, required := range []string{"host", "x-amz-content-sha256", "x-amz-date"} {
+		if !contains(strings.Split(signedHeaders, ";"), required) {
+			return "не подписан заголовок " + required
+		}
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	rawPath, rawQuery, _ := strings.Cut(r.RequestURI, "?")
+	// Канонические параметры: отсортированы, закодированы по правилам S3
+	query, _ := url.ParseQuery(rawQuery)
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, url.QueryEscape(name)+"="+strings.ReplaceAll(url.QueryEscape(value), "+", "%20"))
+		}
+	}
+	sort.Strings(params)
+	canonicalRequest := strings.Join([]string{
+		r.Method, rawPath, strings.Join(params, "&"), canonicalHeaders.String(), signedHeaders, hex.EncodeToString(sum[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+f.secretKey), amzDate[:8])
+	for _, part := range []string{f.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	if want := hex.EncodeToString(hmacSHA256(key, stringToSign)); signature != want {
+		return "подпись не совпадает"
+	}
+	return ""
+}
+
+func TestS3Storage(t *testing.T) {
+	f, server := newFakeS3(t)
+	testStorage(t, f.storage(t, server, ""))
+
+	// Ключи с пробелами и не-ASCII символами передаются закодированными
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	want := "/results/files/1/%D1%84%D0%BE%D1%82%D0%BE%20%D0%BE%D1%82%D0%BF%D1%83%D1%81%D0%BA%D0%B0.jpg"
+	if !contains(f.paths, want) {
+		t.Errorf("запрос к %s не найден среди %q", want, f.paths)
+	}
+	if _, ok := f.objects["files/1/a+b=c&d.txt"]; !ok {
+		t.Errorf("ключ со спецсимволами сохранен неверно: %q", f.paths)
+	}
+}
+
+func TestS3StoragePrefix(t *testing.T) {
+	f, server := newFakeS3(t)
+	storage := f.storage(t, server, "/survey-app/")
+	if err := storage.Put("responses/a.csv", bytes.NewReader([]byte("a"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.objects["survey-app/responses/a.csv"]; !ok {
+		t.Errorf("объект сохранен без общего префикса: %v", f.paths)
+	}
+	keys, err := storage.List("responses/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "responses/a.csv" {
+		t.Errorf("List: %q", keys)
+	}
+}
+
+func TestS3StorageErrors(t *testing.T) {
+	f, server := newFakeS3(t)
+	storage := f.storage(t, server, "")
+
+	// Неверный ключ доступа: ошибка с кодом S3, не os.ErrNotExist
+	f.secretKey, f.forbidden = "other", true
+	err := storage.Put("a.txt", bytes.NewReader([]byte("a")))
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("ошибка подписи не передана: %v", err)
+	}
+	if _, err := storage.Exists("a.txt"); err == nil {
+		t.Error("Exists без ошибки при отказе в доступе")
+	}
+}
+
+func TestS3Escape(t *testing.T) {
+	for _, tc := range []struct {
+		in          string
+		encodeSlash bool
+		want        string
+	}{
+		{"files/a b/c.txt", false, "files/a%20b/c.txt"},
+		{"files/ж.txt", false, "files/%D0%B6.txt"},
+		{"a+b=c&d~e_f-g.h", false, "a%2Bb%3Dc%26d~e_f-g.h"},
+		{"a/b", true, "a%2Fb"},
+	} {
+		if got := s3Escape(tc.in, tc.encodeSlash); got != tc.want {
+			t.Errorf("s3Escape(%q, %v) = %q, ожидалось %q", tc.in, tc.encodeSlash, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// schemaDraft — версия спецификации JSON Schema
+const schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaEnums задает допустимые значения полей вида Тип.поле
+var schemaEnums = map[string][]string{
+	"QuestionData.type": {
+		string(TypeSingleChoice), string(TypeMultiChoice), string(TypeText), string(TypeMixed),
+		string(TypeMatrix), string(TypeNumber), string(TypeDate), string(TypeDateTime),
+		string(TypeEmail), string(TypePhone), string(TypeRanking), string(TypeFileUpload),
+	},
+	"ExportConfig.option_format": {OptionFormatValue, OptionFormatLabel, OptionFormatBoth},
+	"ExportConfig.formats":       exportFormats,
+	"StorageConfig.backend":      storageBackends,
+	"EmailEncryption.method":     emailEncryptionMethods,
+}
+
+// schemaRequired перечисляет обязательные поля структур
+var schemaRequired = map[string][]string{
+	"QuestionData": {"id", "text", "type"},
+	"Survey":       {"questions"},
+	"Option":       {"value"},
+}
+
+// schemaTargets сопоставляет имена схем, доступные в команде schema, с типами
+var schemaTargets = map[string]reflect.Type{
+	"config": reflect.TypeOf(Config{}),
+	"survey": reflect.TypeOf(Survey{}),
+}
+
+// schemaGenerator строит JSON Schema по структурам конфигурации с помощью
+// рефлексии. Вложенные структуры выносятся в $defs.
+type schemaGenerator struct {
+	defs map[string]interface{}
+}
+
+// GenerateSchema возвращает JSON Schema для основной конфигурации ("config")
+// или определения отдельного опроса ("survey")
+func GenerateSchema(target string) (map[string]interface{}, error) {
+	t, ok := schemaTargets[target]
+	if !ok {
+		return nil, fmt.Errorf("неизвестная схема %s: доступны config и survey", target)
+	}
+
+	g := &schemaGenerator{defs: make(map[string]interface{})}
+	schema := g.structSchema(t)
+	schema["$schema"] = schemaDraft
+	schema["title"] = t.Name()
+	schema["$defs"] = g.defs
+	return schema, nil
+}
+
+// WriteSchema выводит JSON Schema в w
+func WriteSchema(w io.Writer, target string) error {
+	schema, err := GenerateSchema(target)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(schema)
+}
+
+// typeSchema возвращает схему значения типа t
+func (g *schemaGenerator) typeSchema(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// Вариант ответа можно записать строкой, числом или объектом
+	if t == reflect.TypeOf(Option{}) {
+		g.define(t)
+		return map[string]interface{}{
+			"oneOf": []interface{}{
+				map[string]interface{}{"type": []string{"string", "number"}},
+				map[string]interface{}{"$ref": "#/$defs/" + t.Name()},
+			},
+		}
+	}
+
+	// Значение по умолчанию — одно значение или список
+	if t == reflect.TypeOf(DefaultValue{}) {
+		scalar := map[string]interface{}{"type": []string{"string", "number"}}
+		return map[string]interface{}{
+			"oneOf": []interface{}{scalar, map[string]interface{}{"type": "array", "items": scalar}},
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.typeSchema(t.Elem())}
+	case reflect.Struct:
+		g.define(t)
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// define добавляет схему структуры в $defs
+func (g *schemaGenerator) define(t reflect.Type) {
+	if _, ok := g.defs[t.Name()]; ok {
+		return
+	}
+	// Резервируем имя до обхода полей на случай рекурсивных типов
+	g.defs[t.Name()] = nil
+	g.defs[t.Name()] = g.structSchema(t)
+}
+
+// structSchema возвращает схему объекта с полями структуры t. Неизвестные
+// поля запрещены, чтобы редактор сразу показывал опечатки в именах.
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for _, name := range schemaFields(t) {
+		sf, _ := schemaField(t, name)
+		property := g.typeSchema(sf.Type)
+		if values, ok := schemaEnums[t.Name()+"."+name]; ok {
+			// Для списков допустимые значения относятся к элементам
+			if items, ok := property["items"].(map[string]interface{}); ok {
+				items["enum"] = values
+			} else {
+				property["enum"] = values
+			}
+		}
+		properties[name] = property
+	}
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if required, ok := schemaRequired[t.Name()]; ok {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// schemaFields возвращает JSON-имена полей структуры в порядке объявления
+func schemaFields(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || sf.PkgPath != "" {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// schemaField находит поле структуры по его JSON-имени
+func schemaField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath == "" && strings.Split(sf.Tag.Get("json"), ",")[0] == name {
+			return sf, true
+		}
+	}
+	return reflect.StructField{}, false
+}
@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"html/template"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"path"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,10 +19,51 @@ import (
 // Session представляет сессию тестирования пользователя
 type Session struct {
 	ID            string
+	// Survey — определение опроса, с которым была начата сессия
+	Survey        *Survey
+	// SurveyVersion — версия определения опроса, которую видел респондент
+	SurveyVersion string
 	StartTime     time.Time
-	AudioFilePath string
+	// FirstInteraction — первое действие респондента на странице опроса,
+	// SubmitTime — получение ответов сервером
+	FirstInteraction time.Time
+	SubmitTime       time.Time
+	// Timings — время работы с вопросами по данным браузера
+	Timings       map[string]QuestionTiming
+	// AudioKey — ключ аудиозаписи сессии в хранилище
+	AudioKey      string
 	Completed     bool
 	Responses     map[string][]string
+	// Typed содержит разобранные значения вопросов с типизированным вводом
+	// (float64 для чисел, time.Time для дат, string для email и телефона,
+	// []string с исходными именами для загруженных файлов)
+	Typed map[string]interface{}
+	// Files содержит ключи файлов, загруженных респондентом
+	Files []string
+	// Seed определяет порядок вопросов и вариантов, показанный в этой сессии
+	Seed int64
+	// QuestionOrder и OptionOrder фиксируют показанный респонденту порядок
+	// вопросов и кодов вариантов ответа
+	QuestionOrder []string
+	OptionOrder   map[string][]string
+	// Language — язык, на котором респондент проходил опрос
+	Language string
+}
+
+// maxFormMemory определяет объем формы, который хранится в памяти при разборе;
+// файлы большего размера временно сохраняются на диск
+const maxFormMemory = 32 << 20
+
+// maxSubmitSize вычисляет максимальный размер запроса с ответами на опрос:
+// сумму допустимых размеров файлов и запас на текстовые поля формы
+func maxSubmitSize(survey *Survey) int64 {
+	var files int64
+	for _, q := range survey.Questions {
+		if q.Type == TypeFileUpload {
+			files += q.UploadLimit() * int64(q.FileLimit())
+		}
+	}
+	return files + 1<<20
 }
 
 // SessionManager управляет сессиями пользователей
@@ -27,16 +72,13 @@ type SessionManager struct {
 	sessions       map[string]*Session
 	responseHandler *ResponseHandler
 	audioRecorder   *AudioRecorder
-	templates      *template.Template
 	mu             sync.RWMutex
 }
 
 // NewSessionManager создает новый менеджер сессий
 func NewSessionManager(config *Config, responseHandler *ResponseHandler, audioRecorder *AudioRecorder) *SessionManager {
-	// Загрузка шаблонов
-	tmpl, err := template.ParseGlob("templates/*.html")
-	if err != nil {
-		log.Fatalf("Ошибка загрузки шаблонов: %v", err)
+	if err := prepareSurveys(config, responseHandler); err != nil {
+		log.Fatalf("Ошибка подготовки опросов: %v", err)
 	}
 
 	return &SessionManager{
@@ -44,18 +86,139 @@ func NewSessionManager(config *Config, responseHandler *ResponseHandler, audioRe
 		sessions:       make(map[string]*Session),
 		responseHandler: responseHandler,
 		audioRecorder:   audioRecorder,
-		templates:      tmpl,
 		mu:             sync.RWMutex{},
 	}
 }
 
-// newSession создает новую сессию
-func (sm *SessionManager) newSession() *Session {
+// prepareSurveys архивирует текущие версии опросов, загружает их шаблоны и
+// задает вопросам часовой пояс ответов
+func prepareSurveys(config *Config, responseHandler *ResponseHandler) error {
+	location := config.location()
+	for _, survey := range config.Surveys {
+		for i := range survey.Questions {
+			survey.Questions[i].location = location
+		}
+
+		archiveKey, err := responseHandler.ArchiveSurvey(survey)
+		if err != nil {
+			return fmt.Errorf("ошибка архивирования опроса %s: %w", survey.ID, err)
+		}
+		survey.archiveKey = archiveKey
+		
+		tmpl, err := loadTemplates(survey.TemplatesDir, config.Catalog)
+		if err != nil {
+			return fmt.Errorf("ошибка загрузки шаблонов опроса %s: %w", survey.ID, err)
+		}
+		survey.templates = tmpl
+	}
+	return nil
+}
+
+// Reload применяет новую конфигурацию. Новые сессии начинаются с новыми
+// определениями опросов, а уже начатые сессии сохраняют определение,
+// с которым были начаты. При ошибке текущая конфигурация не меняется.
+// Хранилище создается при запуске, поэтому его настройки применяются
+// только после перезапуска.
+func (sm *SessionManager) Reload(config *Config) error {
+	if err := prepareSurveys(config, sm.responseHandler); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(config.Storage, sm.currentConfig().Storage) {
+		log.Println("Внимание: настройки хранилища изменены и будут применены после перезапуска")
+	}
+	
+	sm.mu.Lock()
+	sm.config = config
+	sm.mu.Unlock()
+	
+	return nil
+}
+
+// currentConfig возвращает действующую конфигурацию
+func (sm *SessionManager) currentConfig() *Config {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.config
+}
+
+// loadTemplates загружает общие шаблоны и переопределяет их шаблонами
+// из директории опроса, если она указана. Функция t выводит сообщение
+// интерфейса из каталога переводов: {{t $.Lang "submit"}}, функция markdown
+// выводит пояснение к вопросу с простой разметкой.
+func loadTemplates(dir string, catalog Catalog) (*template.Template, error) {
+	if catalog == nil {
+		catalog = builtinCatalog
+	}
+	tmpl, err := template.New("").Funcs(template.FuncMap{
+		"pipe":     pipeHTML,
+		"t":        catalog.Text,
+		"markdown": renderHelpText,
+	}).ParseGlob("templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return tmpl, nil
+	}
+	return tmpl.ParseGlob(filepath.Join(dir, "*.html"))
+}
+
+// render отображает шаблон опроса
+func (sm *SessionManager) render(w http.ResponseWriter, survey *Survey, lang, name string, data interface{}) {
+	if err := survey.templates.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("Ошибка отображения шаблона %s: %v", name, err)
+		http.Error(w, sm.text(lang, "error.internal"), http.StatusInternalServerError)
+	}
+}
+
+// text возвращает сообщение интерфейса на языке lang из каталога переводов
+func (sm *SessionManager) text(lang, key string, args ...interface{}) string {
+	catalog := sm.currentConfig().Catalog
+	if catalog == nil {
+		catalog = builtinCatalog
+	}
+	return catalog.Text(lang, key, args...)
+}
+
+// requestLanguage определяет язык сообщений для запроса, сессия которого
+// неизвестна: по заголовку Accept-Language среди языков каталога
+func (sm *SessionManager) requestLanguage(r *http.Request) string {
+	catalog := sm.currentConfig().Catalog
+	if catalog == nil {
+		catalog = builtinCatalog
+	}
+	languages := make([]string, 0, len(catalog))
+	for lang := range catalog {
+		languages = append(languages, lang)
+	}
+	for _, requested := range parseAcceptLanguage(r.Header.Get("Accept-Language")) {
+		if lang, ok := matchLanguage(requested, languages); ok {
+			return lang
+		}
+	}
+	return defaultLanguage
+}
+
+// sessionLanguage возвращает язык сессии или, если сессия неизвестна, язык запроса
+func (sm *SessionManager) sessionLanguage(r *http.Request, session *Session) string {
+	if session != nil && session.Language != "" {
+		return session.Language
+	}
+	return sm.requestLanguage(r)
+}
+
+// newSession создает новую сессию опроса
+func (sm *SessionManager) newSession(survey *Survey) *Session {
 	sessionID := uuid.New().String()
 	session := &Session{
-		ID:        sessionID,
-		StartTime: time.Now(),
-		Responses: make(map[string][]string),
+		ID:            sessionID,
+		Survey:        survey,
+		SurveyVersion: survey.Version,
+		StartTime:     time.Now(),
+		Responses:     make(map[string][]string),
+		Typed:         make(map[string]interface{}),
+		Seed:          newSeed(),
+		Language:      survey.baseLanguage(),
 	}
 	
 	sm.mu.Lock()
@@ -73,10 +236,74 @@ func (sm *SessionManager) getSession(id string) (*Session, bool) {
 	return session, exists
 }
 
-// HandleSurveyPage обрабатывает запрос на страницу с опросом
+// currentSession возвращает незавершенную сессию опроса из cookie запроса
+func (sm *SessionManager) currentSession(r *http.Request, survey *Survey) (*Session, bool) {
+	cookie, err := r.Cookie("session_id")
+	if err != nil {
+		return nil, false
+	}
+	session, exists := sm.getSession(cookie.Value)
+	if !exists || session.Completed || session.Survey.ID != survey.ID {
+		return nil, false
+	}
+	return session, true
+}
+
+// presentSession возвращает вопросы в порядке показа для сессии на ее языке
+// и запоминает этот порядок в сессии
+func (sm *SessionManager) presentSession(session *Session) []QuestionData {
+	questions := localizeQuestions(presentQuestions(session.Survey, session.Seed), session.Language)
+	
+	questionOrder := make([]string, len(questions))
+	optionOrder := make(map[string][]string)
+	for i, q := range questions {
+		questionOrder[i] = q.ID
+		if len(q.Options) > 0 {
+			optionOrder[q.ID] = optionValues(q.Options)
+		}
+	}
+	
+	sm.mu.Lock()
+	session.QuestionOrder = questionOrder
+	session.OptionOrder = optionOrder
+	sm.mu.Unlock()
+	
+	return questions
+}
+
+// HandleSurveyPage обрабатывает запрос на страницу опроса по умолчанию
 func (sm *SessionManager) HandleSurveyPage(w http.ResponseWriter, r *http.Request) {
-	// Создаем новую сессию для каждого посещения страницы опроса
-	session := sm.newSession()
+	sm.serveSurvey(w, r, sm.currentConfig().DefaultSurvey())
+}
+
+// HandleSurveyByID обрабатывает запрос на страницу опроса по адресу /s/{surveyID}
+func (sm *SessionManager) HandleSurveyByID(w http.ResponseWriter, r *http.Request) {
+	surveyID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/s/"), "/")
+	survey, exists := sm.currentConfig().Survey(surveyID)
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+	sm.serveSurvey(w, r, survey)
+}
+
+// serveSurvey отображает страницу опроса
+func (sm *SessionManager) serveSurvey(w http.ResponseWriter, r *http.Request, survey *Survey) {
+	// Продолжаем незавершенную сессию при перезагрузке страницы, чтобы порядок
+	// вопросов не менялся; для нового посещения создаем новую сессию
+	session, exists := sm.currentSession(r, survey)
+	if !exists {
+		session = sm.newSession(survey)
+	}
+	
+	// Язык выбирается параметром ?lang= или по Accept-Language при первом
+	// посещении; явный выбор меняет язык и начатой сессии
+	lang, explicit := chooseLanguage(r, survey)
+	if !exists || explicit {
+		sm.mu.Lock()
+		session.Language = lang
+		sm.mu.Unlock()
+	}
 	
 	// Устанавливаем cookie с ID сессии
 	cookie := http.Cookie{
@@ -90,44 +317,51 @@ func (sm *SessionManager) HandleSurveyPage(w http.ResponseWriter, r *http.Reques
 	
 	// Отображаем шаблон с вопросами
 	data := struct {
+		Survey    *Survey
+		Title     string
+		Lang      string
+		Languages []string
 		Questions []QuestionData
 		SessionID string
+		Answers   map[string]string
 	}{
-		Questions: sm.config.Questions,
+		Survey:    survey,
+		Title:     survey.LocalizedTitle(session.Language),
+		Lang:      session.Language,
+		Languages: survey.Languages(),
+		Questions: sm.presentSession(session),
 		SessionID: session.ID,
+		Answers:   pipedAnswers(localizeQuestions(survey.Questions, session.Language), session.Responses),
 	}
 	
-	if err := sm.templates.ExecuteTemplate(w, "survey.html", data); err != nil {
-		log.Printf("Ошибка отображения шаблона survey.html: %v", err)
-		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
-	}
+	sm.render(w, survey, session.Language, "survey.html", data)
 }
 
 // HandleStartRecording начинает запись аудио
 func (sm *SessionManager) HandleStartRecording(w http.ResponseWriter, r *http.Request) {
 	sessionID := r.URL.Query().Get("session_id")
 	if sessionID == "" {
-		http.Error(w, "Отсутствует ID сессии", http.StatusBadRequest)
+		http.Error(w, sm.text(sm.requestLanguage(r), "error.no_session"), http.StatusBadRequest)
 		return
 	}
 	
 	session, exists := sm.getSession(sessionID)
 	if !exists {
-		http.Error(w, "Недействительная сессия", http.StatusBadRequest)
+		http.Error(w, sm.text(sm.requestLanguage(r), "error.bad_session"), http.StatusBadRequest)
 		return
 	}
 	
-	// Создаем путь для сохранения аудио
-	audioPath := filepath.Join("uploads", fmt.Sprintf("audio_%s.wav", sessionID))
+	// Формируем ключ для сохранения аудио
+	audioKey := sm.responseHandler.AudioKey(session)
 	
 	// Начинаем запись
-	if err := sm.audioRecorder.StartRecording(sessionID, audioPath); err != nil {
+	if err := sm.audioRecorder.StartRecording(sessionID, audioKey); err != nil {
 		log.Printf("Ошибка начала записи: %v", err)
-		http.Error(w, "Не удалось начать запись", http.StatusInternalServerError)
+		http.Error(w, sm.text(session.Language, "error.start_record"), http.StatusInternalServerError)
 		return
 	}
 	
-	session.AudioFilePath = audioPath
+	session.AudioKey = audioKey
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -135,59 +369,147 @@ func (sm *SessionManager) HandleStartRecording(w http.ResponseWriter, r *http.Re
 func (sm *SessionManager) HandleStopRecording(w http.ResponseWriter, r *http.Request) {
 	sessionID := r.URL.Query().Get("session_id")
 	if sessionID == "" {
-		http.Error(w, "Отсутствует ID сессии", http.StatusBadRequest)
+		http.Error(w, sm.text(sm.requestLanguage(r), "error.no_session"), http.StatusBadRequest)
 		return
 	}
 	
 	// Останавливаем запись
 	if err := sm.audioRecorder.StopRecording(sessionID); err != nil {
 		log.Printf("Ошибка остановки записи: %v", err)
-		http.Error(w, "Не удалось остановить запись", http.StatusInternalServerError)
+		session, _ := sm.getSession(sessionID)
+		http.Error(w, sm.text(sm.sessionLanguage(r, session), "error.stop_record"), http.StatusInternalServerError)
 		return
 	}
 	
 	w.WriteHeader(http.StatusOK)
 }
 
+// submitLimit возвращает допустимый размер запроса с ответами. Тело запроса
+// еще не прочитано, поэтому сессия определяется по ID в адресе формы, и лимит
+// считается по ее опросу. Для форм без ID в адресе (например, из своих
+// шаблонов опроса) используется наибольший лимит опросов конфигурации.
+func (sm *SessionManager) submitLimit(r *http.Request) int64 {
+	if session, ok := sm.getSession(r.URL.Query().Get("session_id")); ok {
+		return maxSubmitSize(session.Survey)
+	}
+	var limit int64
+	for _, survey := range sm.currentConfig().Surveys {
+		if size := maxSubmitSize(survey); size > limit {
+			limit = size
+		}
+	}
+	return limit
+}
+
 // HandleSubmit обрабатывает отправку формы с ответами
 func (sm *SessionManager) HandleSubmit(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Ошибка обработки формы", http.StatusBadRequest)
+	// Ограничиваем размер запроса суммой допустимых размеров файлов
+	config := sm.currentConfig()
+	r.Body = http.MaxBytesReader(w, r.Body, sm.submitLimit(r))
+	if err := r.ParseMultipartForm(maxFormMemory); err != nil && err != http.ErrNotMultipart {
+		http.Error(w, sm.text(sm.requestLanguage(r), "error.form"), http.StatusBadRequest)
 		return
 	}
 	
 	sessionID := r.FormValue("session_id")
 	if sessionID == "" {
-		http.Error(w, "Отсутствует ID сессии", http.StatusBadRequest)
+		http.Error(w, sm.text(sm.requestLanguage(r), "error.no_session"), http.StatusBadRequest)
 		return
 	}
 	
 	session, exists := sm.getSession(sessionID)
 	if !exists {
-		http.Error(w, "Недействительная сессия", http.StatusBadRequest)
+		http.Error(w, sm.text(sm.requestLanguage(r), "error.bad_session"), http.StatusBadRequest)
 		return
 	}
+	lang := session.Language
 	
-	// Сохраняем ответы
-	for _, question := range sm.config.Questions {
-		values := r.Form[question.ID]
-		// Для вопросов с произвольным ответом добавляем его отдельно
-		if question.AllowCustom {
-			customAnswer := r.FormValue(question.ID + "_custom")
-			if customAnswer != "" {
-				values = append(values, customAnswer)
+	// Время отправки фиксируется при получении ответов; по нему же отметки
+	// браузера переводятся во время сервера
+	session.SubmitTime = time.Now()
+	if err := applyTimings(session, r.FormValue(timingsField)); err != nil {
+		log.Printf("Отметки времени сессии %s не сохранены: %v", session.ID, err)
+	}
+	
+	// Сохраняем ответы. Вопросы проверяются на языке сессии и с подставленными
+	// ответами, чтобы сообщения об ошибках ссылались на тексты, которые видел
+	// респондент. Ответы собираются в копию и применяются к сессии только
+	// после успешной проверки всей формы.
+	responses := make(map[string][]string, len(session.Responses))
+	for id, values := range session.Responses {
+		responses[id] = values
+	}
+	typedAnswers := make(map[string]interface{}, len(session.Typed))
+	for id, value := range session.Typed {
+		typedAnswers[id] = value
+	}
+	localized := localizeQuestions(session.Survey.Questions, lang)
+	for _, question := range localized {
+		question = pipeQuestion(question, pipedAnswers(localized, responses))
+		answers, typed, err := collectAnswers(question, r.Form)
+		if err != nil {
+			http.Error(w, sm.text(lang, "error.answers", err), http.StatusBadRequest)
+			return
+		}
+		for id, values := range answers {
+			responses[id] = values
+		}
+		for id, value := range typed {
+			typedAnswers[id] = value
+		}
+	}
+	
+	// Проверяем загруженные файлы до сохранения, чтобы не оставлять файлы
+	// от отклоненной отправки
+	uploads := make(map[string][]*multipart.FileHeader)
+	for _, question := range localized {
+		if question.Type != TypeFileUpload {
+			continue
+		}
+		question = pipeQuestion(question, pipedAnswers(localized, responses))
+		files, err := collectUploads(question, r.MultipartForm)
+		if err != nil {
+			http.Error(w, sm.text(lang, "error.answers", err), http.StatusBadRequest)
+			return
+		}
+		uploads[question.ID] = files
+	}
+	
+	// Сохраняем загруженные файлы. Имя файла респондента может содержать
+	// личные данные, а ключи хранилища не шифруются, поэтому файлы хранятся
+	// под именами <ID вопроса>_<номер><расширение>. Исходные имена попадают
+	// только в запись сессии, которая шифруется вместе с ответами.
+	var savedFiles []string
+	for _, question := range session.Survey.Questions {
+		var names, originals []string
+		for i, fh := range uploads[question.ID] {
+			key, err := sm.saveUpload(session.ID, fmt.Sprintf("%s_%d%s", question.ID, i+1, uploadExtension(fh.Filename)), fh)
+			if err != nil {
+				log.Printf("Ошибка сохранения файла: %v", err)
+				http.Error(w, sm.text(lang, "error.save_file"), http.StatusInternalServerError)
+				return
+			}
+			savedFiles = append(savedFiles, key)
+			names = append(names, path.Base(key))
+			originals = append(originals, fh.Filename)
+		}
+		if question.Type == TypeFileUpload {
+			responses[question.ID] = names
+			if len(originals) > 0 {
+				typedAnswers[question.ID] = originals
 			}
 		}
-		session.Responses[question.ID] = values
 	}
+	session.Responses, session.Typed = responses, typedAnswers
+	session.Files = append(session.Files, savedFiles...)
 	
 	// Останавливаем запись аудио, если она не была остановлена ранее
 	sm.audioRecorder.StopRecording(sessionID)
 	
 	// Сохраняем ответы
-	if err := sm.responseHandler.SaveResponses(session.ID, session.Responses, sm.config.Questions); err != nil {
+	if err := sm.responseHandler.SaveResponses(session, config.Export); err != nil {
 		log.Printf("Ошибка сохранения ответов: %v", err)
-		http.Error(w, "Не удалось сохранить ответы", http.StatusInternalServerError)
+		http.Error(w, sm.text(lang, "error.save_answers"), http.StatusInternalServerError)
 		return
 	}
 	
@@ -203,50 +525,142 @@ func (sm *SessionManager) HandleSubmit(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/complete?session_id="+sessionID, http.StatusSeeOther)
 }
 
+// saveUpload сохраняет один загруженный файл сессии
+func (sm *SessionManager) saveUpload(sessionID, name string, fh *multipart.FileHeader) (string, error) {
+	file, err := fh.Open()
+	if err != nil {
+		return "", fmt.Errorf("не удалось открыть загруженный файл: %w", err)
+	}
+	defer file.Close()
+	
+	return sm.responseHandler.SaveUpload(sessionID, name, file)
+}
+
 // HandleComplete отображает страницу завершения
 func (sm *SessionManager) HandleComplete(w http.ResponseWriter, r *http.Request) {
 	sessionID := r.URL.Query().Get("session_id")
 	if sessionID == "" {
-		http.Error(w, "Отсутствует ID сессии", http.StatusBadRequest)
+		http.Error(w, sm.text(sm.requestLanguage(r), "error.no_session"), http.StatusBadRequest)
 		return
 	}
 	
+	// Незавершенная сессия возвращается к своему опросу, неизвестная — к
+	// опросу по умолчанию
 	session, exists := sm.getSession(sessionID)
-	if !exists || !session.Completed {
+	if !exists {
 		http.Redirect(w, r, "/survey", http.StatusSeeOther)
 		return
 	}
+	if !session.Completed {
+		http.Redirect(w, r, session.Survey.URL(), http.StatusSeeOther)
+		return
+	}
 	
-	if err := sm.templates.ExecuteTemplate(w, "complete.html", nil); err != nil {
-		log.Printf("Ошибка отображения шаблона complete.html: %v", err)
-		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+	data := struct {
+		Survey *Survey
+		Title  string
+		Lang   string
+	}{
+		Survey: session.Survey,
+		Title:  session.Survey.LocalizedTitle(session.Language),
+		Lang:   session.Language,
 	}
+	
+	sm.render(w, session.Survey, session.Language, "complete.html", data)
 }
 
-// SendResults отправляет результаты на email
+// SendResults отправляет результаты на email. Итог отправки записывается в
+// журнал доставки: по нему неудачные отправки повторяются, а файлы
+// доставленных сессий удаляются по истечении срока хранения.
 func (sm *SessionManager) SendResults(session *Session) error {
-	// Получаем путь к CSV файлу с ответами
-	csvPath, err := sm.responseHandler.GetResponseFile(session.ID)
+	// Получаем ключи файлов с ответами (CSV и JSON)
+	files, err := sm.responseHandler.GetResponseFiles(session)
 	if err != nil {
-		return fmt.Errorf("не удалось получить файл с ответами: %w", err)
+		return fmt.Errorf("не удалось получить файлы с ответами: %w", err)
 	}
 	
-	// Создаем архив
-	zipPath := filepath.Join("uploads", fmt.Sprintf("results_%s.zip", session.ID))
-	files := []string{csvPath}
-	
 	// Добавляем аудио файл, если он существует
-	if session.AudioFilePath != "" {
-		files = append(files, session.AudioFilePath)
+	if session.AudioKey != "" {
+		files = append(files, session.AudioKey)
 	}
 	
-	if err := CreateZipArchive(zipPath, files); err != nil {
+	// Добавляем файлы, загруженные респондентом
+	files = append(files, session.Files...)
+	
+	delivery := &Delivery{
+		SessionID:     session.ID,
+		SurveyID:      session.Survey.ID,
+		SurveyVersion: session.SurveyVersion,
+		Language:      session.Language,
+		Respondents:   sm.responseHandler.respondentHashes(session),
+		Files:         files,
+		Archive:       sm.responseHandler.ArchiveKey(session),
+		Definition:    session.Survey.archiveKey,
+		SubmittedAt:   session.SubmitTime.UTC(),
+	}
+	return sm.deliver(delivery, session)
+}
+
+// deliver собирает архив результатов, отправляет его и записывает итог
+// попытки в журнал доставки
+func (sm *SessionManager) deliver(delivery *Delivery, session *Session) error {
+	// Отметка о начале отправки сохраняется заранее, чтобы сбой во время
+	// отправки не оставил сессию вне журнала
+	delivery.Status = DeliveryPending
+	delivery.LastAttempt = time.Now().UTC()
+	if err := sm.responseHandler.SaveDelivery(delivery); err != nil {
+		return err
+	}
+
+	return sm.recordAttempt(delivery, sm.sendArchive(delivery, session))
+}
+
+// recordAttempt записывает в журнал доставки исход попытки отправки и
+// отказывается от отправки после max_attempts неудач подряд
+func (sm *SessionManager) recordAttempt(delivery *Delivery, err error) error {
+	delivery.Attempts++
+	if err != nil {
+		delivery.Status = DeliveryFailed
+		delivery.Error = err.Error()
+		if delivery.Attempts >= sm.currentConfig().Retention.maxAttempts() {
+			sm.responseHandler.abandonDelivery(delivery)
+			return err
+		}
+	} else {
+		delivery.Status = DeliveryDelivered
+		delivery.DeliveredAt = timePointer(time.Now().UTC())
+		delivery.Error = ""
+	}
+	if saveErr := sm.responseHandler.SaveDelivery(delivery); saveErr != nil {
+		log.Printf("Ошибка записи журнала доставки: %v", saveErr)
+	}
+	return err
+}
+
+// sendArchive создает архив с файлами сессии и отправляет его по email
+func (sm *SessionManager) sendArchive(delivery *Delivery, session *Session) error {
+	storage := sm.responseHandler.storage
+	
+	files := append([]string{}, delivery.Files...)
+	// Добавляем определение версии опроса, на которую отвечал респондент
+	if delivery.Definition != "" {
+		files = append(files, delivery.Definition)
+	}
+	
+	if err := CreateZipArchive(storage, delivery.Archive, files); err != nil {
 		return fmt.Errorf("ошибка создания архива: %w", err)
 	}
 	
 	// Отправляем архив по email
-	emailer := NewEmailer(sm.config)
-	if err := emailer.SendZipResults(zipPath, session.ID); err != nil {
+	archive, err := storage.Get(delivery.Archive)
+	if err != nil {
+		return fmt.Errorf("архив не найден: %w", err)
+	}
+	defer archive.Close()
+	
+	contents := sm.responseHandler.archiveContents(files, delivery.Definition)
+	emailer := NewEmailer(sm.currentConfig())
+	if err := emailer.SendZipResults(archive, path.Base(delivery.Archive), contents, session); err != nil {
 		return fmt.Errorf("ошибка отправки email: %w", err)
 	}
 	
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newTestManager создает менеджер сессий с конфигурацией config (JSON) и
+// локальным хранилищем во временной директории
+func newTestManager(t *testing.T, config string) *SessionManager {
+	t.Helper()
+	loaded := loadTestConfig(t, config)
+	loaded.Storage = StorageConfig{Dir: t.TempDir()}
+	storage, err := NewStorage(loaded.Storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rh := NewResponseHandler(storage, loaded.Storage.Prefixes, loaded.RespondentKey)
+	return NewSessionManager(loaded, rh, NewAudioRecorder(storage))
+}
+
+// submitForm отправляет ответы сессии
+func submitForm(sm *SessionManager, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/submit", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	sm.HandleSubmit(rec, req)
+	return rec
+}
+
+func TestSubmitErrorPipesQuestionText(t *testing.T) {
+	sm := newTestManager(t, `{
+		"smtp_host": "127.0.0.1", "smtp_port": 1,
+		"email": {"to": "a@example.com", "from": "a@example.com"},
+		"questions": [
+			{"id": "fruit", "text": "Фрукт", "type": "single_choice", "options": ["Яблоко", "Груша"], "required": true},
+			{"id": "why", "text": "Почему {{fruit}}?", "type": "number", "required": true}
+		]
+	}`)
+	session := sm.newSession(sm.currentConfig().Surveys[0])
+
+	rec := submitForm(sm, url.Values{"session_id": {session.ID}, "fruit": {"Груша"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("код ответа %d, ожидался 400", rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "«Почему Груша?»") {
+		t.Errorf("сообщение без подставленного ответа: %s", body)
+	}
+}
+
+func TestSubmitLimitUsesSessionSurvey(t *testing.T) {
+	sm := newTestManager(t, `{
+		"smtp_host": "127.0.0.1", "smtp_port": 1,
+		"email": {"to": "a@example.com", "from": "a@example.com"},
+		"questions": [{"id": "photo", "text": "Фото", "type": "file_upload", "max_file_size": 1048576, "max_files": 3}]
+	}`)
+	session := sm.newSession(sm.currentConfig().Surveys[0])
+
+	// После перезагрузки в конфигурации остается опрос без файлов, но
+	// начатая сессия отправляет форму своего опроса
+	sm.currentConfig().Surveys = []*Survey{{ID: "default"}}
+	req := httptest.NewRequest(http.MethodPost, "/submit?session_id="+session.ID, nil)
+	if got, want := sm.submitLimit(req), int64(3<<20+1<<20); got != want {
+		t.Errorf("лимит %d, ожидался %d", got, want)
+	}
+	if got, want := sm.submitLimit(httptest.NewRequest(http.MethodPost, "/submit", nil)), int64(1<<20); got != want {
+		t.Errorf("лимит без ID сессии %d, ожидался %d", got, want)
+	}
+}
+
+func TestSubmitFailureKeepsResponses(t *testing.T) {
+	sm := newTestManager(t, `{
+		"smtp_host": "127.0.0.1", "smtp_port": 1,
+		"email": {"to": "a@example.com", "from": "a@example.com"},
+		"questions": [
+			{"id": "name", "text": "Имя", "type": "text"},
+			{"id": "age", "text": "Возраст", "type": "number", "required": true}
+		]
+	}`)
+	session := sm.newSession(sm.currentConfig().Surveys[0])
+	session.Responses["name"] = []string{"Анна"}
+
+	rec := submitForm(sm, url.Values{"session_id": {session.ID}, "name": {"Борис"}, "age": {"много"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("код ответа %d, ожидался 400", rec.Code)
+	}
+	if got := session.Responses["name"]; len(got) != 1 || got[0] != "Анна" {
+		t.Errorf("ответы сессии изменены отклоненной отправкой: %v", got)
+	}
+	if _, ok := session.Typed["age"]; ok {
+		t.Error("в сессии сохранено значение из отклоненной отправки")
+	}
+}
+
+func TestSubmitUploadUsesOpaqueKeys(t *testing.T) {
+	sm := newTestManager(t, `{
+		"smtp_host": "127.0.0.1", "smtp_port": 1,
+		"email": {"to": "a@example.com", "from": "a@example.com"},
+		"questions": [{"id": "scan", "text": "Скан", "type": "file_upload", "max_files": 2}]
+	}`)
+	session := sm.newSession(sm.currentConfig().Surveys[0])
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("session_id", session.ID)
+	part, err := mw.CreateFormFile("scan", "Паспорт Иванова.JSON")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(`{"a": 1}`))
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/submit", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	sm.HandleSubmit(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("код ответа %d: %s", rec.Code, rec.Body.String())
+	}
+
+	want := "files/" + session.ID + "/scan_1.json"
+	if len(session.Files) != 1 || session.Files[0] != want {
+		t.Errorf("ключи файлов %v, ожидался %s", session.Files, want)
+	}
+	keys, err := sm.responseHandler.storage.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record string
+	for _, key := range keys {
+		if strings.Contains(key, "Иванова") {
+			t.Errorf("исходное имя файла в ключе %s", key)
+		}
+		data := readObject(t, sm.responseHandler.storage, key)
+		if strings.HasPrefix(key, "deliveries/") && strings.Contains(data, "Иванова") {
+			t.Errorf("исходное имя файла в журнале доставки: %s", data)
+		}
+		if strings.HasSuffix(key, ".json") && strings.HasPrefix(key, "responses/") {
+			record = data
+		}
+	}
+	if !strings.Contains(record, "Паспорт Иванова.JSON") {
+		t.Errorf("исходное имя файла не сохранено в записи сессии: %s", record)
+	}
+}
+
+func TestArchiveContentsListsArchivedFiles(t *testing.T) {
+	rh := &ResponseHandler{prefixes: StoragePrefixes{}.resolved()}
+	got := rh.archiveContents([]string{
+		"responses/responses_default_s1.csv",
+		"responses/responses_default_s1.json",
+		"versions/default/v1.json",
+	}, "versions/default/v1.json")
+	want := []string{
+		"Ответы пользователя в форматах CSV, JSON",
+		"Определение версии опроса с текстом вопросов",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("без аудиозаписи и файлов: %q, ожидалось %q", got, want)
+	}
+
+	rh.suffix = encryptedSuffix
+	got = rh.archiveContents([]string{
+		"responses/responses_default_s1.xlsx.age",
+		"audio_default_s1.wav.age",
+		"files/s1/scan_1.wav.age",
+		"files/s1/scan_2.pdf.age",
+	}, "")
+	want = []string{
+		"Ответы пользователя в форматах Excel",
+		"Аудиозапись, сделанная во время прохождения опроса",
+		"Файлы, загруженные пользователем: 2",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("с аудиозаписью и файлами: %q, ожидалось %q", got, want)
+	}
+}
+
+func TestCompleteRedirectsToSessionSurvey(t *testing.T) {
+	sm := newTestManager(t, `{
+		"smtp_host": "127.0.0.1", "smtp_port": 1,
+		"email": {"to": "a@example.com", "from": "a@example.com"},
+		"questions": [{"id": "name", "text": "Имя", "type": "text"}]
+	}`)
+	survey := &Survey{ID: "feedback"}
+	session := sm.newSession(survey)
+
+	for id, want := range map[string]string{session.ID: "/s/feedback", "unknown": "/survey"} {
+		rec := httptest.NewRecorder()
+		sm.HandleComplete(rec, httptest.NewRequest(http.MethodGet, "/complete?session_id="+id, nil))
+		if got := rec.Header().Get("Location"); rec.Code != http.StatusSeeOther || got != want {
+			t.Errorf("сессия %s: %d %s, ожидался переход на %s", id, rec.Code, got, want)
+		}
+	}
+}
+
+func TestSurveyPageShowsDefaultsAndHints(t *testing.T) {
+	sm := newTestManager(t, `{
+		"smtp_host": "127.0.0.1", "smtp_port": 1,
+		"email": {"to": "a@example.com", "from": "a@example.com"},
+		"questions": [
+			{"id": "city", "text": "Город", "type": "text", "default": "Москва", "placeholder": "Например, Тверь"},
+			{"id": "pet", "text": "Питомец", "type": "single_choice", "options": ["Кошка", "Собака"], "default": "Собака",
+			 "help_text": "Выберите **одного**"}
+		]
+	}`)
+	rec := httptest.NewRecorder()
+	sm.HandleSurveyPage(rec, httptest.NewRequest(http.MethodGet, "/survey", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`placeholder="Например, Тверь"`,
+		`>Москва</textarea>`,
+		`value="Собака" checked`,
+		`<div class="help-text"><p>Выберите <strong>одного</strong></p></div>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("на странице нет %s", want)
+		}
+	}
+	if strings.Contains(body, `value="Кошка" checked`) {
+		t.Error("выбран вариант не по умолчанию")
+	}
+}
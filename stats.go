@@ -0,0 +1,391 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Форматы статистической выгрузки: данные в CSV с числовыми кодами и файл
+// синтаксиса SPSS или скрипт R, который загружает их с метками
+const (
+	statFormatSPSS = "spss"
+	statFormatR    = "r"
+)
+
+// statType — тип переменной статистического набора
+type statType int
+
+const (
+	statString statType = iota
+	statNumeric
+	statDate
+	statDateTime
+)
+
+// Уровни измерения переменных в терминах SPSS
+const (
+	levelNominal = "NOMINAL"
+	levelOrdinal = "ORDINAL"
+	levelScale   = "SCALE"
+)
+
+// statDateTimeFormat — формат даты и времени в данных, понятный SPSS и R
+const statDateTimeFormat = "2006-01-02 15:04:05"
+
+// valueLabel — метка числового кода
+type valueLabel struct {
+	Code  string
+	Label string
+}
+
+// statVariable — переменная статистического набора, построенная по столбцу
+// сводного набора данных
+type statVariable struct {
+	// Name — имя, допустимое в SPSS и R
+	Name   string
+	Label  string
+	Type   statType
+	Level  string
+	// Format — формат SPSS, если он отличается от формата по типу и уровню
+	Format string
+	Labels []valueLabel
+	// column — столбец сводного набора, codes — перевод его значений
+	// (кодов и подписей вариантов) в числовые коды
+	column string
+	codes  map[string]string
+}
+
+// statNameInvalid — символы, недопустимые в именах переменных
+var statNameInvalid = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// statReserved — зарезервированные слова SPSS, которые нельзя использовать
+// как имена переменных
+var statReserved = []string{"ALL", "AND", "BY", "EQ", "GE", "GT", "LE", "LT", "NE", "NOT", "OR", "TO", "WITH"}
+
+// statVariables строит переменные статистического набора по определению
+// опроса. Варианты ответа кодируются числами: если все коды вариантов —
+// целые числа (например, шкала 1–5), используются они, иначе номера
+// вариантов по порядку. Варианты вопросов с несколькими ответами выгружаются
+// индикаторами 0/1.
+func statVariables(survey *Survey, optionFormat string) []statVariable {
+	variables := []statVariable{
+		{column: "session_id", Label: "ID сессии", Type: statString, Level: levelNominal},
+		{column: "survey_version", Label: "Версия опроса", Type: statString, Level: levelNominal},
+		{column: "language", Label: "Язык", Type: statString, Level: levelNominal},
+		{column: "started_at", Label: "Начало", Type: statDateTime, Level: levelScale},
+		{column: "first_interaction_at", Label: "Первое действие", Type: statDateTime, Level: levelScale},
+		{column: "submitted_at", Label: "Отправка", Type: statDateTime, Level: levelScale},
+		{column: "duration_seconds", Label: "Длительность, с", Type: statNumeric, Level: levelScale},
+		{column: "audio", Label: "Аудиозапись", Type: statString, Level: levelNominal},
+	}
+
+	for _, column := range datasetColumns(survey.Questions, optionFormat) {
+		v := statVariable{column: column.Name, Label: column.Label, Type: statString, Level: levelNominal}
+		switch {
+		case column.Indicator:
+			v.Type = statNumeric
+			v.Labels = []valueLabel{{"0", "Нет"}, {"1", "Да"}}
+		case len(column.Options) > 0:
+			v.Type = statNumeric
+			v.codes = make(map[string]string)
+			for i, code := range optionCodes(column.Options) {
+				option := column.Options[i]
+				v.codes[option.Value] = code
+				v.codes[option.Label] = code
+				v.Labels = append(v.Labels, valueLabel{code, option.Label})
+			}
+		case column.Kind == columnDuration:
+			v.Type, v.Level, v.Format = statNumeric, levelScale, "F8.2"
+		case column.Kind == columnNumber:
+			v.Type = statNumeric
+			v.Level = levelScale
+			if column.Type == TypeRanking {
+				v.Level = levelOrdinal
+			}
+		case column.Kind == columnDate:
+			v.Type, v.Level = statDate, levelScale
+		case column.Kind == columnDateTime:
+			v.Type, v.Level = statDateTime, levelScale
+		}
+		variables = append(variables, v)
+	}
+
+	// Имена приводятся к допустимым и не должны совпадать без учета регистра:
+	// SPSS не различает регистр имен
+	used := make(map[string]bool)
+	for i := range variables {
+		name := statNameInvalid.ReplaceAllString(variables[i].column, "_")
+		if c := name[0]; !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z') {
+			name = "v" + name
+		}
+		if len(name) > 60 {
+			name = name[:60]
+		}
+		if contains(statReserved, strings.ToUpper(name)) {
+			name += "_"
+		}
+		unique := name
+		for n := 2; used[strings.ToUpper(unique)]; n++ {
+			unique = fmt.Sprintf("%s_%d", name, n)
+		}
+		used[strings.ToUpper(unique)] = true
+		variables[i].Name = unique
+	}
+	return variables
+}
+
+// optionCodes возвращает числовые коды вариантов ответа
+func optionCodes(options []Option) []string {
+	codes := make([]string, len(options))
+	seen := make(map[int]bool)
+	numeric := true
+	for i, option := range options {
+		n, err := strconv.Atoi(option.Value)
+		if err != nil || seen[n] {
+			numeric = false
+			break
+		}
+		seen[n] = true
+		codes[i] = strconv.Itoa(n)
+	}
+	if !numeric {
+		for i := range options {
+			codes[i] = strconv.Itoa(i + 1)
+		}
+	}
+	return codes
+}
+
+// statRows переводит строки сводного набора в строки статистического набора
+// с заголовком из имен переменных
+func statRows(variables []statVariable, dataset surveyDataset) [][]string {
+	index := make(map[string]int, len(dataset.Header))
+	for i, name := range dataset.Header {
+		index[name] = i
+	}
+
+	header := make([]string, len(variables))
+	for i, v := range variables {
+		header[i] = v.Name
+	}
+	rows := [][]string{header}
+
+	for _, record := range dataset.Rows {
+		row := make([]string, len(variables))
+		for i, v := range variables {
+			j, ok := index[v.column]
+			if !ok || j >= len(record) {
+				continue
+			}
+			row[i] = statValue(v, record[j])
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// statValue переводит значение сводного набора в значение переменной
+func statValue(v statVariable, raw string) string {
+	switch {
+	case raw == "":
+		return ""
+	case v.codes != nil:
+		return v.codes[raw]
+	case v.Type == statDateTime:
+		if t, err := time.Parse(exportDateTimeFormat, raw); err == nil {
+			return t.Format(statDateTimeFormat)
+		}
+	}
+	return raw
+}
+
+// WriteStatExport записывает zip-архив со статистическим набором версии
+// опроса: данные в CSV и файл синтаксиса SPSS (.sps) или скрипт R (.R)
+func WriteStatExport(w io.Writer, dataset surveyDataset, optionFormat, format string) error {
+	survey := dataset.Survey
+	name := fmt.Sprintf("dataset_%s_%s", survey.ID, survey.Version)
+	variables := statVariables(survey, optionFormat)
+	rows := statRows(variables, dataset)
+
+	zw := zip.NewWriter(w)
+	data, err := zw.Create(name + ".csv")
+	if err != nil {
+		return fmt.Errorf("ошибка записи архива: %w", err)
+	}
+	writer := csv.NewWriter(data)
+	if err := writer.WriteAll(rows); err != nil {
+		return fmt.Errorf("ошибка записи данных: %w", err)
+	}
+
+	var script string
+	switch format {
+	case statFormatSPSS:
+		script = spssSyntax(variables, rows, survey, name+".csv")
+		name += ".sps"
+	case statFormatR:
+		script = rScript(variables, survey, name+".csv")
+		name += ".R"
+	default:
+		return fmt.Errorf("неизвестный формат статистической выгрузки %s", format)
+	}
+	if err := writeZipPart(zw, name, script); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("ошибка записи архива: %w", err)
+	}
+	return nil
+}
+
+// spssSyntax формирует синтаксис SPSS, который читает CSV и задает метки
+// переменных и значений и уровни измерения
+func spssSyntax(variables []statVariable, rows [][]string, survey *Survey, dataFile string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "* Опрос %s, версия %s.\n", survey.ID, survey.Version)
+	b.WriteString("* Запустите синтаксис из директории с файлом данных или укажите полный путь в /FILE.\n\n")
+
+	fmt.Fprintf(&b, "GET DATA\n  /TYPE=TXT\n  /FILE=%s\n  /ENCODING='UTF8'\n", spssQuote(dataFile, 0))
+	b.WriteString("  /DELCASE=LINE\n  /DELIMITERS=\",\"\n  /QUALIFIER='\"'\n  /ARRANGEMENT=DELIMITED\n  /FIRSTCASE=2\n  /VARIABLES=\n")
+	for i, v := range variables {
+		format := v.Format
+		switch {
+		case format != "":
+		case v.Type == statNumeric:
+			format = "F8.0"
+			if v.Level == levelScale {
+				format = "F12.4"
+			}
+		case v.Type == statDate:
+			format = "SDATE10"
+		case v.Type == statDateTime:
+			format = "YMDHMS19"
+		default:
+			// Ширина строковой переменной — наибольшая длина значения в байтах
+			width := 1
+			for _, row := range rows[1:] {
+				if len(row[i]) > width {
+					width = len(row[i])
+				}
+			}
+			if width > 32767 {
+				width = 32767
+			}
+			format = fmt.Sprintf("A%d", width)
+		}
+		fmt.Fprintf(&b, "    %s %s\n", v.Name, format)
+	}
+	b.WriteString(".\n\nVARIABLE LABELS\n")
+	for i, v := range variables {
+		separator := "  "
+		if i > 0 {
+			separator = "  /"
+		}
+		fmt.Fprintf(&b, "%s%s %s\n", separator, v.Name, spssQuote(v.Label, 255))
+	}
+	b.WriteString(".\n")
+
+	var labeled []string
+	for _, v := range variables {
+		if len(v.Labels) == 0 {
+			continue
+		}
+		line := v.Name
+		for _, l := range v.Labels {
+			line += " " + l.Code + " " + spssQuote(l.Label, 120)
+		}
+		labeled = append(labeled, line)
+	}
+	if len(labeled) > 0 {
+		b.WriteString("\nVALUE LABELS\n  " + strings.Join(labeled, "\n  /") + ".\n")
+	}
+
+	var levels []string
+	for _, level := range []string{levelNominal, levelOrdinal, levelScale} {
+		var names []string
+		for _, v := range variables {
+			if v.Level == level {
+				names = append(names, v.Name)
+			}
+		}
+		if len(names) > 0 {
+			levels = append(levels, fmt.Sprintf("%s (%s)", strings.Join(names, " "), level))
+		}
+	}
+	b.WriteString("\nVARIABLE LEVEL\n  " + strings.Join(levels, "\n  /") + ".\n\nEXECUTE.\n")
+	return b.String()
+}
+
+// spssQuote заключает текст в апострофы SPSS, обрезая его до limit байт
+// (0 — без ограничения)
+func spssQuote(text string, limit int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if limit > 0 {
+		text = truncateBytes(text, limit)
+	}
+	return "'" + strings.ReplaceAll(text, "'", "''") + "'"
+}
+
+// truncateBytes обрезает строку до n байт, не разрывая символы UTF-8
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// rScript формирует скрипт R, который читает CSV, преобразует даты и
+// варианты ответа в факторы с подписями и задает метки переменных в
+// атрибуте label (его понимают пакеты Hmisc, labelled и haven)
+func rScript(variables []statVariable, survey *Survey, dataFile string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Опрос %s, версия %s\n", survey.ID, survey.Version)
+	b.WriteString("# Выполните source() из директории с файлом данных\n\n")
+
+	classes := make([]string, len(variables))
+	for i, v := range variables {
+		class := "character"
+		if v.Type == statNumeric {
+			class = "numeric"
+		}
+		classes[i] = fmt.Sprintf("%s = %s", v.Name, rQuote(class))
+	}
+	fmt.Fprintf(&b, "data <- read.csv(%s, fileEncoding = \"UTF-8\", stringsAsFactors = FALSE,\n", rQuote(dataFile))
+	fmt.Fprintf(&b, "  na.strings = \"\", colClasses = c(\n    %s\n  ))\n\n", strings.Join(classes, ",\n    "))
+
+	for _, v := range variables {
+		column := "data$" + v.Name
+		switch {
+		case v.Type == statDate:
+			fmt.Fprintf(&b, "%s <- as.Date(%s)\n", column, column)
+		case v.Type == statDateTime:
+			fmt.Fprintf(&b, "%s <- as.POSIXct(%s, format = \"%%Y-%%m-%%d %%H:%%M:%%S\")\n", column, column)
+		case len(v.Labels) > 0:
+			codes := make([]string, len(v.Labels))
+			labels := make([]string, len(v.Labels))
+			for i, l := range v.Labels {
+				codes[i] = l.Code
+				labels[i] = rQuote(l.Label)
+			}
+			fmt.Fprintf(&b, "%s <- factor(%s, levels = c(%s), labels = c(%s))\n",
+				column, column, strings.Join(codes, ", "), strings.Join(labels, ", "))
+		}
+		fmt.Fprintf(&b, "attr(%s, \"label\") <- %s\n", column, rQuote(v.Label))
+	}
+	return b.String()
+}
+
+// rQuote заключает текст в кавычки R
+func rQuote(text string) string {
+	text = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "").Replace(text)
+	return `"` + text + `"`
+}
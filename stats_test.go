@@ -0,0 +1,150 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strings"
+	"testing"
+)
+
+// statSurvey — опрос с вариантами ответа: коды шкалы — целые числа,
+// коды цветов — нет, а вопрос с несколькими ответами выгружается индикаторами
+func statSurvey() *Survey {
+	return &Survey{ID: "s", Version: "v1", Questions: []QuestionData{
+		{ID: "score", Text: "Оценка", Type: TypeSingleChoice, Options: []Option{
+			{Value: "5", Label: "Отлично"}, {Value: "3", Label: "Средне"}, {Value: "1", Label: "Плохо"},
+		}},
+		{ID: "color", Text: "Цвет", Type: TypeSingleChoice, Options: []Option{
+			{Value: "red", Label: "Красный"}, {Value: "blue", Label: "Синий 'морской'"},
+		}},
+		{ID: "pets", Text: "Питомцы", Type: TypeMultiChoice, Options: []Option{
+			{Value: "cat", Label: "Кошка"}, {Value: "dog", Label: "Собака"},
+		}},
+	}}
+}
+
+// readStatExport возвращает строки CSV и текст скрипта из статистической
+// выгрузки
+func readStatExport(t *testing.T, dataset surveyDataset, optionFormat, format string) ([][]string, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteStatExport(&buf, dataset, optionFormat, format); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("выгрузка не является zip-архивом: %v", err)
+	}
+	var rows [][]string
+	var script string
+	for _, file := range reader.File {
+		body, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(file.Name, ".csv") {
+			if rows, err = csv.NewReader(bytes.NewReader(content)).ReadAll(); err != nil {
+				t.Fatalf("%s: %v", file.Name, err)
+			}
+		} else {
+			script = string(content)
+		}
+	}
+	if rows == nil || script == "" {
+		t.Fatalf("в выгрузке нет данных или скрипта: %d файлов", len(reader.File))
+	}
+	return rows, script
+}
+
+// statColumn возвращает значения столбца name без заголовка
+func statColumn(t *testing.T, rows [][]string, name string) []string {
+	t.Helper()
+	for i, header := range rows[0] {
+		if header == name {
+			var values []string
+			for _, row := range rows[1:] {
+				values = append(values, row[i])
+			}
+			return values
+		}
+	}
+	t.Fatalf("столбец %s не найден в %v", name, rows[0])
+	return nil
+}
+
+func TestStatExportCodesAndValueLabels(t *testing.T) {
+	survey := statSurvey()
+	for _, tc := range []struct {
+		optionFormat string
+		rows         [][]string
+	}{
+		{OptionFormatValue, [][]string{{"a", "3", "blue", "1", "0"}, {"b", "", "red", "0", "1"}}},
+		{OptionFormatLabel, [][]string{{"a", "Средне", "Синий 'морской'", "1", "0"}, {"b", "", "Красный", "0", "1"}}},
+	} {
+		dataset := surveyDataset{
+			Survey: survey,
+			Header: []string{"session_id", "score", "color", "pets_cat", "pets_dog"},
+			Rows:   tc.rows,
+		}
+		rows, syntax := readStatExport(t, dataset, tc.optionFormat, statFormatSPSS)
+
+		// Целые коды шкалы сохраняются, остальные заменяются номерами вариантов
+		for name, want := range map[string][]string{
+			"score": {"3", ""}, "color": {"2", "1"}, "pets_cat": {"1", "0"}, "pets_dog": {"0", "1"},
+		} {
+			if got := statColumn(t, rows, name); strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("%s: столбец %s = %q, ожидалось %q", tc.optionFormat, name, got, want)
+			}
+		}
+
+		for _, want := range []string{
+			"\nVALUE LABELS\n",
+			"score 5 'Отлично' 3 'Средне' 1 'Плохо'\n",
+			"/color 1 'Красный' 2 'Синий ''морской'''\n",
+			"/pets_cat 0 'Нет' 1 'Да'\n",
+			"    score F8.0\n",
+			"  /score 'Оценка'\n",
+		} {
+			if !strings.Contains(syntax, want) {
+				t.Errorf("%s: в синтаксисе SPSS нет %q:\n%s", tc.optionFormat, want, syntax)
+			}
+		}
+	}
+}
+
+func TestStatExportRFactors(t *testing.T) {
+	dataset := surveyDataset{
+		Survey: statSurvey(),
+		Header: []string{"session_id", "score", "color", "pets_cat", "pets_dog"},
+		Rows:   [][]string{{"a", "5", "red", "1", "1"}},
+	}
+	rows, script := readStatExport(t, dataset, OptionFormatValue, statFormatR)
+	if got := statColumn(t, rows, "score"); got[0] != "5" {
+		t.Errorf("код оценки %q, ожидался 5", got[0])
+	}
+	for _, want := range []string{
+		`score = "numeric"`,
+		`data$score <- factor(data$score, levels = c(5, 3, 1), labels = c("Отлично", "Средне", "Плохо"))`,
+		`data$color <- factor(data$color, levels = c(1, 2), labels = c("Красный", "Синий 'морской'"))`,
+		`data$pets_dog <- factor(data$pets_dog, levels = c(0, 1), labels = c("Нет", "Да"))`,
+		`attr(data$color, "label") <- "Цвет"`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("в скрипте R нет %q:\n%s", want, script)
+		}
+	}
+}
+
+func TestStatExportRejectsUnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteStatExport(&buf, surveyDataset{Survey: statSurvey()}, OptionFormatValue, "sas"); err == nil {
+		t.Error("неизвестный формат не отклонен")
+	}
+}
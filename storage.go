@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Storage — хранилище результатов: ответов, аудиозаписей, загруженных
+// файлов, наборов данных и архивов. Объекты адресуются ключами — путями
+// с разделителем "/" относительно корня хранилища.
+type Storage interface {
+	// Put записывает объект целиком, заменяя существующий
+	Put(key string, r io.Reader) error
+	// Get открывает объект для чтения. Для отсутствующего объекта
+	// возвращается ошибка, для которой errors.Is(err, os.ErrNotExist).
+	Get(key string) (io.ReadCloser, error)
+	// Append дописывает данные в конец объекта, создавая его при необходимости
+	Append(key string, data []byte) error
+	// Exists проверяет наличие объекта
+	Exists(key string) (bool, error)
+	// Delete удаляет объект; отсутствие объекта ошибкой не считается
+	Delete(key string) error
+	// List возвращает отсортированные ключи объектов, начинающиеся с prefix
+	List(prefix string) ([]string, error)
+}
+
+// Типы хранилищ результатов
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+// storageBackends перечисляет поддерживаемые типы хранилищ
+var storageBackends = []string{StorageLocal, StorageS3}
+
+// defaultStorageDir — корень локального хранилища по умолчанию
+const defaultStorageDir = "uploads"
+
+// StorageConfig содержит настройки хранилища результатов
+type StorageConfig struct {
+	// Backend — тип хранилища: local (по умолчанию) или s3
+	Backend string `json:"backend,omitempty"`
+	// Dir — корневая директория локального хранилища (uploads по умолчанию)
+	Dir string `json:"dir,omitempty"`
+	// Prefixes задает расположение данных разных видов внутри хранилища
+	Prefixes StoragePrefixes `json:"prefixes,omitempty"`
+	// S3 содержит настройки S3-совместимого хранилища
+	S3 S3Config `json:"s3,omitempty"`
+	// Encryption включает шифрование записываемых объектов
+	Encryption EncryptionConfig `json:"encryption,omitempty"`
+}
+
+// StoragePrefixes — префиксы ключей для данных разных видов. Незаданные
+// префиксы принимают значения по умолчанию; аудиозаписи и архивы результатов
+// по умолчанию хранятся в корне хранилища.
+type StoragePrefixes struct {
+	Responses  string `json:"responses,omitempty"`
+	Files      string `json:"files,omitempty"`
+	Audio      string `json:"audio,omitempty"`
+	Archives   string `json:"archives,omitempty"`
+	Datasets   string `json:"datasets,omitempty"`
+	Versions   string `json:"versions,omitempty"`
+	Deliveries string `json:"deliveries,omitempty"`
+	Audit      string `json:"audit,omitempty"`
+	Tombstones string `json:"tombstones,omitempty"`
+}
+
+// resolved возвращает префиксы со значениями по умолчанию вместо незаданных
+func (p StoragePrefixes) resolved() StoragePrefixes {
+	if p.Responses == "" {
+		p.Responses = "responses"
+	}
+	if p.Files == "" {
+		p.Files = "files"
+	}
+	if p.Datasets == "" {
+		p.Datasets = "datasets"
+	}
+	if p.Versions == "" {
+		p.Versions = "versions"
+	}
+	if p.Deliveries == "" {
+		p.Deliveries = "deliveries"
+	}
+	if p.Audit == "" {
+		p.Audit = "audit"
+	}
+	if p.Tombstones == "" {
+		p.Tombstones = "tombstones"
+	}
+	return p
+}
+
+// storageKey формирует ключ объекта из префикса и имени
+func storageKey(prefix string, name ...string) string {
+	return path.Join(append([]string{prefix}, name...)...)
+}
+
+// validStorageKey проверяет, что ключ относителен и не выходит за корень хранилища
+func validStorageKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// NewStorage создает хранилище по настройкам. Если задано шифрование,
+// хранилище оборачивается в EncryptedStorage.
+func NewStorage(config StorageConfig) (Storage, error) {
+	var storage Storage
+	var err error
+	switch config.Backend {
+	case "", StorageLocal:
+		dir := config.Dir
+		if dir == "" {
+			dir = defaultStorageDir
+		}
+		storage, err = NewLocalStorage(dir)
+	case StorageS3:
+		storage, err = NewS3Storage(config.S3)
+	default:
+		return nil, fmt.Errorf("неизвестный тип хранилища %s", config.Backend)
+	}
+	if err != nil || !config.Encryption.enabled() {
+		return storage, err
+	}
+	return NewEncryptedStorage(storage, config.Encryption)
+}
+
+// LocalStorage хранит объекты файлами в директории на диске
+type LocalStorage struct {
+	dir string
+}
+
+// NewLocalStorage создает локальное хранилище в директории dir
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("не удалось создать директорию хранилища %s: %w", dir, err)
+	}
+	return &LocalStorage{dir: dir}, nil
+}
+
+// path возвращает путь к файлу объекта
+func (s *LocalStorage) path(key string) (string, error) {
+	if !validStorageKey(key) {
+		return "", fmt.Errorf("недопустимый ключ хранилища %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put записывает объект в файл
+func (s *LocalStorage) Put(key string, r io.Reader) error {
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("не удалось создать директорию %s: %w", filepath.Dir(filePath), err)
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("не удалось создать файл %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	// Недописанный файл удаляется, чтобы не оставлять поврежденный объект
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		os.Remove(filePath)
+		return fmt.Errorf("ошибка записи файла %s: %w", filePath, err)
+	}
+	return file.Close()
+}
+
+// Get открывает файл объекта
+func (s *LocalStorage) Get(key string) (io.ReadCloser, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(filePath)
+}
+
+// Append дописывает данные в файл объекта одним вызовом записи, чтобы они
+// не перемешались с данными других процессов
+func (s *LocalStorage) Append(key string, data []byte) error {
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("не удалось создать директорию %s: %w", filepath.Dir(filePath), err)
+	}
+
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть файл %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("ошибка записи в файл %s: %w", filePath, err)
+	}
+	return file.Close()
+}
+
+// Exists проверяет наличие файла объекта
+func (s *LocalStorage) Exists(key string) (bool, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !info.IsDir(), nil
+}
+
+// Delete удаляет файл объекта
+func (s *LocalStorage) Delete(key string) error {
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("не удалось удалить файл %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// Shred затирает содержимое файла объекта случайными данными и удаляет его
+// вместе с опустевшими директориями, чтобы данные нельзя было восстановить с диска
+func (s *LocalStorage) Shred(key string) error {
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filePath, os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("не удалось открыть файл %s: %w", filePath, err)
+	}
+	info, err := file.Stat()
+	if err == nil {
+		_, err = io.CopyN(file, rand.Reader, info.Size())
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("не удалось затереть файл %s: %w", filePath, err)
+	}
+	if err := s.Delete(key); err != nil {
+		return err
+	}
+
+	// Пустые директории (например, файлы сессии в files/<ID сессии>)
+	// удаляются вплоть до корня хранилища
+	for dir := filepath.Dir(filePath); dir != filepath.Clean(s.dir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// shredObject безвозвратно удаляет объект: в локальном хранилище его
+// содержимое сначала затирается, в остальных объект просто удаляется
+func shredObject(storage Storage, key string) error {
+	if encrypted, ok := storage.(*EncryptedStorage); ok {
+		storage = encrypted.Storage
+	}
+	if local, ok := storage.(*LocalStorage); ok {
+		return local.Shred(key)
+	}
+	return storage.Delete(key)
+}
+
+// List обходит директорию хранилища и возвращает ключи файлов с префиксом
+func (s *LocalStorage) List(prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.Walk(s.dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, filePath)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения директории хранилища %s: %w", s.dir, err)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
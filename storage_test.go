@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readObject читает объект хранилища целиком
+func readObject(t *testing.T, storage Storage, key string) string {
+	t.Helper()
+	body, err := storage.Get(key)
+	if err != nil {
+		t.Fatalf("Get %s: %v", key, err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("Get %s: %v", key, err)
+	}
+	return string(data)
+}
+
+// testStorage проверяет поведение хранилища, общее для всех реализаций
+// интерфейса Storage
+func testStorage(t *testing.T, storage Storage) {
+	keys := []string{
+		"responses/responses_default_1.csv",
+		"files/1/фото отпуска.jpg",
+		"files/1/a+b=c&d.txt",
+		"audio_default_1.wav",
+	}
+	for _, key := range keys {
+		if err := storage.Put(key, strings.NewReader("data of "+key)); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+	for _, key := range keys {
+		if got := readObject(t, storage, key); got != "data of "+key {
+			t.Errorf("Get %s: %q", key, got)
+		}
+	}
+
+	// Put заменяет объект целиком
+	if err := storage.Put(keys[0], strings.NewReader("new")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readObject(t, storage, keys[0]); got != "new" {
+		t.Errorf("после замены: %q", got)
+	}
+
+	// Append создает объект и дописывает в конец
+	for _, line := range []string{"a\n", "b\n"} {
+		if err := storage.Append("responses/log.jsonl", []byte(line)); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	if got := readObject(t, storage, "responses/log.jsonl"); got != "a\nb\n" {
+		t.Errorf("после Append: %q", got)
+	}
+
+	if exists, err := storage.Exists(keys[1]); err != nil || !exists {
+		t.Errorf("Exists %s: %v, %v", keys[1], exists, err)
+	}
+	if exists, err := storage.Exists("files/2/none.txt"); err != nil || exists {
+		t.Errorf("Exists для отсутствующего объекта: %v, %v", exists, err)
+	}
+	if _, err := storage.Get("files/2/none.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Get для отсутствующего объекта: %v", err)
+	}
+
+	list, err := storage.List("files/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"files/1/a+b=c&d.txt", "files/1/фото отпуска.jpg"}; !reflect.DeepEqual(list, want) {
+		t.Errorf("List files/: %q, ожидалось %q", list, want)
+	}
+	all, err := storage.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(keys)+1 {
+		t.Errorf("List: %q", all)
+	}
+
+	if err := storage.Delete(keys[1]); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := storage.Exists(keys[1]); exists {
+		t.Errorf("объект %s не удален", keys[1])
+	}
+	// Удаление отсутствующего объекта ошибкой не считается
+	if err := storage.Delete(keys[1]); err != nil {
+		t.Errorf("повторное удаление: %v", err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "files/../../x"} {
+		if err := storage.Put(key, strings.NewReader("x")); err == nil {
+			t.Errorf("Put принял недопустимый ключ %q", key)
+		}
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	storage, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, storage)
+}
+
+func TestLocalStorageShred(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put("files/1/a.txt", strings.NewReader("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put("files/2/b.txt", strings.NewReader("other")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := shredObject(storage, "files/1/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "files", "1")); !os.IsNotExist(err) {
+		t.Errorf("пустая директория сессии не удалена: %v", err)
+	}
+	if exists, _ := storage.Exists("files/2/b.txt"); !exists {
+		t.Error("удален чужой файл")
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("удален корень хранилища: %v", err)
+	}
+	// Отсутствующий объект
+	if err := shredObject(storage, "files/1/a.txt"); err != nil {
+		t.Errorf("повторное удаление: %v", err)
+	}
+}
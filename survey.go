@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// DefaultSurveyID — ID опроса, заданного вопросами основного файла конфигурации
+const DefaultSurveyID = "default"
+
+// surveyIDPattern ограничивает ID опроса символами, безопасными для URL и имен файлов
+var surveyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// surveyVersionPattern ограничивает версию опроса символами, безопасными для имен файлов
+var surveyVersionPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Survey представляет отдельный опрос со своими вопросами, получателями и шаблонами
+type Survey struct {
+	ID    string      `json:"id"`
+	Title string      `json:"title,omitempty"`
+	Email EmailConfig `json:"email"`
+	// Version идентифицирует редакцию вопросов. Если версия не указана,
+	// она вычисляется как хеш содержимого опроса.
+	Version string `json:"version,omitempty"`
+
+	Questions []QuestionData `json:"questions"`
+	// RandomizeQuestions включает перемешивание порядка вопросов для каждой сессии
+	RandomizeQuestions bool `json:"randomize_questions,omitempty"`
+
+	// TemplatesDir указывает директорию с шаблонами опроса; шаблоны,
+	// которых в ней нет, берутся из общей директории templates
+	TemplatesDir string `json:"templates_dir,omitempty"`
+
+	// Language — язык текстов опроса (ru, если не указан); Translations
+	// задает перевод заголовка на другие языки
+	Language     string                       `json:"language,omitempty"`
+	Translations map[string]SurveyTranslation `json:"translations,omitempty"`
+
+	// archiveKey — ключ сохраненного в архиве определения этой версии
+	archiveKey string
+	// templates — шаблоны, загруженные вместе с этой версией опроса
+	templates *template.Template
+}
+
+// URL возвращает адрес страницы опроса
+func (s *Survey) URL() string {
+	if s.ID == DefaultSurveyID {
+		return "/survey"
+	}
+	return "/s/" + s.ID
+}
+
+// contentHash вычисляет версию опроса по его содержимому: заголовку, вопросам,
+// порядку показа и переводам. Настройки получателей на версию не влияют.
+func (s *Survey) contentHash() string {
+	content, _ := json.Marshal(struct {
+		Title              string                       `json:"title"`
+		Questions          []QuestionData               `json:"questions"`
+		RandomizeQuestions bool                         `json:"randomize_questions"`
+		Language           string                       `json:"language,omitempty"`
+		Translations       map[string]SurveyTranslation `json:"translations,omitempty"`
+	}{s.Title, s.Questions, s.RandomizeQuestions, s.Language, s.Translations})
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:6])
+}
+
+// randomized проверяет, включено ли в опросе перемешивание вопросов или вариантов
+func (s *Survey) randomized() bool {
+	if s.RandomizeQuestions {
+		return true
+	}
+	for _, q := range s.Questions {
+		if q.RandomizeOptions {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadSurveys загружает определения опросов из директории. ID опроса берется
+// из файла, а если он не указан — из имени файла. Незаполненные настройки
+// email дополняются значениями по умолчанию из основной конфигурации.
+func LoadSurveys(dir string, defaults EmailConfig) ([]*Survey, error) {
+	paths, err := surveyFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	surveys := make([]*Survey, 0, len(paths))
+	for _, path := range paths {
+		survey, err := LoadSurvey(path)
+		if err != nil {
+			return nil, err
+		}
+		prepareSurveyFile(survey, path, defaults)
+		surveys = append(surveys, survey)
+	}
+
+	return surveys, nil
+}
+
+// surveyFiles возвращает отсортированный список файлов опросов в директории
+func surveyFiles(dir string) ([]string, error) {
+	entries, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска опросов в %s: %w", dir, err)
+	}
+	var paths []string
+	for _, path := range entries {
+		if isConfigFile(path) {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("в директории %s нет определений опросов", dir)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// prepareSurveyFile дополняет опрос, загруженный из файла path: ID по имени
+// файла, путь к шаблонам относительно файла и настройки email по умолчанию
+func prepareSurveyFile(survey *Survey, path string, defaults EmailConfig) {
+	if survey.ID == "" {
+		survey.ID = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if survey.TemplatesDir != "" && !filepath.IsAbs(survey.TemplatesDir) {
+		survey.TemplatesDir = filepath.Join(filepath.Dir(path), survey.TemplatesDir)
+	}
+	survey.Email = mergeEmail(survey.Email, defaults)
+}
+
+// LoadSurvey загружает определение одного опроса из файла JSON, YAML или TOML
+func LoadSurvey(path string) (*Survey, error) {
+	var survey Survey
+	if err := decodeConfigFile(path, &survey); err != nil {
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			return nil, fmt.Errorf("невозможно открыть файл опроса: %w", err)
+		}
+		return nil, fmt.Errorf("опрос %s: %w", path, err)
+	}
+
+	return &survey, nil
+}
+
+// ArchiveSurvey сохраняет определение версии опроса в хранилище по ключу
+// <prefix>/<surveyID>/survey_<surveyID>_<version>.json,
+// чтобы ответы всегда можно было сопоставить с вопросами, на которые они даны.
+// Уже сохраненная версия не перезаписывается. Если опрос изменен, а версия
+// осталась прежней, возвращается ошибка: иначе ответы на новые тексты
+// вопросов выгружались бы с версией, тексты которой респонденты не видели.
+func ArchiveSurvey(storage Storage, prefix string, survey *Survey) (string, error) {
+	// Пароль архива для писем не сохраняется: определение версии попадает
+	// в архив результатов вместе с ответами
+	definition := *survey
+	definition.Email.Encryption.Password = ""
+	content, err := json.MarshalIndent(&definition, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("ошибка кодирования опроса %s: %w", survey.ID, err)
+	}
+
+	key := storageKey(prefix, survey.ID, surveyArchiveName(survey.ID, survey.Version))
+	exists, err := storage.Exists(key)
+	if err != nil {
+		return "", fmt.Errorf("ошибка проверки архива опроса %s: %w", key, err)
+	}
+	if exists {
+		archived, err := loadArchivedSurvey(storage, key)
+		if err != nil {
+			return "", err
+		}
+		if archived.contentHash() != survey.contentHash() {
+			return "", fmt.Errorf("опрос %s изменен без смены версии %s: укажите новую версию или уберите version, чтобы она вычислялась по содержимому", survey.ID, survey.Version)
+		}
+		return key, nil
+	}
+
+	if err := storage.Put(key, bytes.NewReader(content)); err != nil {
+		return "", fmt.Errorf("не удалось сохранить архив опроса %s: %w", key, err)
+	}
+	return key, nil
+}
+
+// LoadSurveyVersion загружает сохраненное в архиве определение версии опроса
+func LoadSurveyVersion(storage Storage, prefix, surveyID, version string) (*Survey, error) {
+	if !surveyIDPattern.MatchString(surveyID) || !surveyVersionPattern.MatchString(version) {
+		return nil, fmt.Errorf("недопустимый ID или версия опроса")
+	}
+	return loadArchivedSurvey(storage, storageKey(prefix, surveyID, surveyArchiveName(surveyID, version)))
+}
+
+// loadArchivedSurvey читает определение опроса из архива версий
+func loadArchivedSurvey(storage Storage, key string) (*Survey, error) {
+	body, err := storage.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("невозможно открыть архив опроса: %w", err)
+	}
+	defer body.Close()
+
+	var survey Survey
+	if err := json.NewDecoder(body).Decode(&survey); err != nil {
+		return nil, fmt.Errorf("опрос %s: %w", key, err)
+	}
+	return &survey, nil
+}
+
+// surveyArchiveName формирует имя файла версии опроса в архиве
+func surveyArchiveName(surveyID, version string) string {
+	return fmt.Sprintf("survey_%s_%s.json", surveyID, version)
+}
+
+// mergeEmail дополняет незаполненные настройки email значениями по умолчанию
+func mergeEmail(email, defaults EmailConfig) EmailConfig {
+	if email.To == "" {
+		email.To = defaults.To
+	}
+	if email.From == "" {
+		email.From = defaults.From
+	}
+	if email.Subject == "" {
+		email.Subject = defaults.Subject
+	}
+	// Шифрование задается для получателя целиком, поэтому наследуется,
+	// только если у опроса оно не задано вовсе
+	if email.Encryption.Method == "" && len(email.Encryption.Recipients) == 0 && email.Encryption.Password == "" {
+		email.Encryption = defaults.Encryption
+	}
+	return email
+}
+
+// validateSurvey проверяет корректность определения опроса и возвращает
+// первую найденную ошибку
+func validateSurvey(survey *Survey) error {
+	if problems := surveyProblems(survey); len(problems) > 0 {
+		return errors.New(problems[0].Message)
+	}
+	return nil
+}
+
+// surveyProblems возвращает все ошибки в определении опроса в порядке
+// их расположения в файле
+func surveyProblems(survey *Survey) []problem {
+	var problems []problem
+	add := func(path, format string, args ...interface{}) {
+		problems = append(problems, problem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !surveyIDPattern.MatchString(survey.ID) {
+		add("id", "недопустимый ID опроса: допускаются латинские буквы, цифры, _ и -")
+	}
+
+	if survey.Version != "" && !surveyVersionPattern.MatchString(survey.Version) {
+		add("version", "недопустимая версия опроса %s: допускаются латинские буквы, цифры, точка, _ и -", survey.Version)
+	}
+
+	if survey.Email.To == "" {
+		add("email.to", "email получателя не указан")
+	}
+
+	if survey.Email.From == "" {
+		add("email.from", "email отправителя не указан")
+	}
+
+	encryption := survey.Email.Encryption
+	switch encryption.Method {
+	case "", EmailEncryptionNone:
+	case EmailEncryptionAge:
+		if len(encryption.Recipients) == 0 {
+			add("email.encryption.recipients", "не заданы открытые ключи age получателя")
+		}
+		for i, key := range encryption.Recipients {
+			if _, err := age.ParseX25519Recipient(key); err != nil {
+				add(fmt.Sprintf("email.encryption.recipients[%d]", i), "некорректный открытый ключ age %s", key)
+			}
+		}
+	case EmailEncryptionZip:
+		if encryption.Password == "" {
+			add("email.encryption.password", "не задан пароль архива")
+		}
+	default:
+		add("email.encryption.method", "неизвестный способ шифрования %s: допустимы %s", encryption.Method, strings.Join(emailEncryptionMethods, ", "))
+	}
+
+	if len(survey.Questions) == 0 {
+		add("questions", "список вопросов пуст")
+		return problems
+	}
+
+	ids := make(map[string]bool)
+	for i, q := range survey.Questions {
+		// Ошибки вопроса указывают на его поле: questions[i].поле
+		addq := func(field, format string, args ...interface{}) {
+			path := questionPath(i, field)
+			add(path, "вопрос #%d: "+format, append([]interface{}{i + 1}, args...)...)
+		}
+
+		if q.ID == "" {
+			addq("", "отсутствует ID")
+		} else if ids[q.ID] {
+			addq("id", "повторяющийся ID %s", q.ID)
+		}
+		ids[q.ID] = true
+		if q.Text == "" {
+			addq("", "отсутствует текст вопроса")
+		}
+
+		for _, list := range []struct {
+			field   string
+			options []Option
+		}{{"options", q.Options}, {"columns", q.Columns}} {
+			seen := make(map[string]bool)
+			for j, option := range list.options {
+				switch {
+				case option.Value == "":
+					addq(fmt.Sprintf("%s[%d]", list.field, j), "у варианта ответа отсутствует значение")
+				case seen[option.Value]:
+					addq(fmt.Sprintf("%s[%d]", list.field, j), "вариант «%s» повторяется", option.Value)
+				}
+				seen[option.Value] = true
+			}
+		}
+
+		switch q.Type {
+		case TypeSingleChoice, TypeMultiChoice:
+			if len(q.Options) == 0 {
+				addq("type", "тип %s требует наличия вариантов ответа", q.Type)
+			}
+		case TypeMixed:
+			if len(q.Options) == 0 || !q.AllowCustom {
+				addq("type", "тип mixed требует наличия вариантов ответа и разрешения ввода пользователя")
+			}
+		case TypeText:
+			// Для текстовых вопросов нет специальных требований
+		case TypeNumber:
+			if q.Min != nil && q.Max != nil && *q.Min > *q.Max {
+				addq("min", "минимальное значение больше максимального")
+			}
+			if q.Step < 0 {
+				addq("step", "шаг не может быть отрицательным")
+			}
+		case TypeFileUpload:
+			if q.MaxFileSize < 0 || q.MaxFiles < 0 {
+				addq("", "ограничения на файлы не могут быть отрицательными")
+			}
+			for j, t := range q.AllowedTypes {
+				if !strings.Contains(t, "/") {
+					addq(fmt.Sprintf("allowed_types[%d]", j), "некорректный MIME-тип %s", t)
+				}
+			}
+		case TypeDate, TypeDateTime, TypeEmail, TypePhone:
+			// Формат ответа определяется самим типом
+		case TypeMatrix:
+			if len(q.Rows) == 0 || len(q.Columns) == 0 {
+				addq("type", "тип matrix требует наличия строк и столбцов")
+			}
+			if err := registerItemIDs(ids, q, len(q.Rows)); err != nil {
+				addq("rows", "%v", err)
+			}
+		case TypeRanking:
+			if len(q.Options) < 2 {
+				addq("options", "тип ranking требует не менее двух вариантов")
+			}
+			if err := registerItemIDs(ids, q, len(q.Options)); err != nil {
+				addq("options", "%v", err)
+			}
+		default:
+			addq("type", "неизвестный тип %s", q.Type)
+		}
+
+		if len(q.Default) > 0 {
+			if err := validateDefault(q); err != nil {
+				addq("default", "некорректное значение по умолчанию: %v", err)
+			}
+		}
+		if q.Image != "" && !validImage(q.Image) {
+			addq("image", "изображение должно быть адресом http(s) или путем от корня сайта, например /static/q1.png")
+		}
+	}
+
+	problems = append(problems, columnProblems(survey)...)
+	problems = append(problems, translationProblems(survey)...)
+	return append(problems, pipeProblems(survey)...)
+}
+
+// columnProblems проверяет, что имена столбцов сводного набора разных
+// вопросов не совпадают между собой и со служебными столбцами: например,
+// столбец времени x_dwell вопроса x и вопрос x_dwell или индикатор варианта 1
+// вопроса m и вопрос m_1. Совпадения ID вопросов и элементов матриц и
+// рейтингов уже проверены выше и здесь не повторяются.
+func columnProblems(survey *Survey) []problem {
+	index := make(map[string]int, len(survey.Questions))
+	for i, q := range survey.Questions {
+		if _, ok := index[q.ID]; !ok {
+			index[q.ID] = i
+		}
+	}
+
+	var problems []problem
+	owners := make(map[string]datasetColumn)
+	for _, name := range datasetMeta {
+		owners[name] = datasetColumn{Name: name}
+	}
+	for _, column := range datasetColumns(survey.Questions, OptionFormatValue) {
+		other, taken := owners[column.Name]
+		if !taken {
+			owners[column.Name] = column
+			continue
+		}
+		if other.Question == column.Question || (other.Question != "" && other.answerKey() && column.answerKey()) {
+			continue
+		}
+		i := index[column.Question]
+		with := "служебным столбцом"
+		if other.Question != "" {
+			with = "столбцом вопроса " + other.Question
+		}
+		problems = append(problems, problem{
+			Path:    questionPath(i, "id"),
+			Message: fmt.Sprintf("вопрос #%d: столбец набора данных %s совпадает со %s", i+1, column.Name, with),
+		})
+	}
+	return problems
+}
+
+// questionPath возвращает путь к полю вопроса с индексом i в файле опроса
+func questionPath(i int, field string) string {
+	path := fmt.Sprintf("questions[%d]", i)
+	if field != "" {
+		path += "." + field
+	}
+	return path
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadTestConfig загружает конфигурацию из текста JSON
+func loadTestConfig(t *testing.T, text string) *Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestArchiveSurveyRejectsChangedVersion(t *testing.T) {
+	const config = `{
+		"smtp_host": "127.0.0.1", "smtp_port": 1,
+		"email": {"to": "a@example.com", "from": "a@example.com"},
+		"version": "v1",
+		"questions": [
+			{"id": "q1", "text": "%s", "type": "single_choice", "options": ["1", {"value": "2", "label": "Два"}], "default": "1"},
+			{"id": "n", "text": "Число", "type": "number", "min": 0, "step": 0.5},
+			{"id": "m", "text": "Матрица", "type": "matrix", "rows": ["a"], "columns": ["x"],
+			 "translations": {"en": {"text": "Matrix"}}}
+		]
+	}`
+	storage, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := func(text string) error {
+		survey := loadTestConfig(t, strings.Replace(config, "%s", text, 1)).Surveys[0]
+		_, err := ArchiveSurvey(storage, "versions", survey)
+		return err
+	}
+
+	if err := archive("Вопрос"); err != nil {
+		t.Fatal(err)
+	}
+	// Повторный запуск с тем же определением
+	if err := archive("Вопрос"); err != nil {
+		t.Fatalf("неизмененный опрос отклонен: %v", err)
+	}
+	if err := archive("Другой вопрос"); err == nil {
+		t.Fatal("измененный опрос с прежней версией принят")
+	}
+}
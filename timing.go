@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// timingsField — скрытое поле формы, в котором браузер передает отметки
+// времени работы с опросом
+const timingsField = "_timings"
+
+// QuestionTiming — время работы респондента с вопросом по данным браузера
+type QuestionTiming struct {
+	// FirstAnswer и LastAnswer — время первого и последнего изменения ответа
+	FirstAnswer time.Time
+	LastAnswer  time.Time
+	// Dwell — сколько вопрос был активен (в фокусе или последним измененным)
+	// при открытой вкладке
+	Dwell time.Duration
+}
+
+// clientTimings — отметки времени из браузера в миллисекундах от загрузки
+// страницы. SentAt — момент отправки формы, по нему отметки переводятся во
+// время сервера, поэтому часы устройства респондента не важны.
+type clientTimings struct {
+	FirstInteraction *float64 `json:"first_interaction"`
+	SentAt           float64  `json:"sent_at"`
+	Questions        map[string]struct {
+		First *float64 `json:"first"`
+		Last  *float64 `json:"last"`
+		Dwell float64  `json:"dwell"`
+	} `json:"questions"`
+}
+
+// applyTimings записывает в сессию отметки времени из поля формы. Отметки
+// отсчитываются от session.SubmitTime и ограничиваются интервалом от начала
+// сессии до отправки; вопросы, которых нет в опросе, пропускаются. Если поле
+// пустое (в браузере отключен JavaScript), сессия остается без отметок.
+func applyTimings(session *Session, raw string) error {
+	if raw == "" {
+		return nil
+	}
+	var timings clientTimings
+	if err := json.Unmarshal([]byte(raw), &timings); err != nil {
+		return fmt.Errorf("ошибка разбора отметок времени: %w", err)
+	}
+
+	at := func(ms float64) time.Time {
+		t := session.SubmitTime.Add(-time.Duration((timings.SentAt - ms) * float64(time.Millisecond)))
+		if t.Before(session.StartTime) {
+			return session.StartTime
+		}
+		if t.After(session.SubmitTime) {
+			return session.SubmitTime
+		}
+		return t
+	}
+
+	if timings.FirstInteraction != nil {
+		session.FirstInteraction = at(*timings.FirstInteraction)
+	}
+	session.Timings = make(map[string]QuestionTiming)
+	total := session.SubmitTime.Sub(session.StartTime)
+	for _, q := range session.Survey.Questions {
+		client, ok := timings.Questions[q.ID]
+		if !ok {
+			continue
+		}
+		var timing QuestionTiming
+		if client.First != nil {
+			timing.FirstAnswer = at(*client.First)
+		}
+		if client.Last != nil {
+			timing.LastAnswer = at(*client.Last)
+		}
+		timing.Dwell = time.Duration(client.Dwell * float64(time.Millisecond))
+		if timing.Dwell < 0 {
+			timing.Dwell = 0
+		}
+		if timing.Dwell > total {
+			timing.Dwell = total
+		}
+		session.Timings[q.ID] = timing
+	}
+	return nil
+}
+
+// timePointer возвращает указатель на время или nil для нулевого времени,
+// чтобы неизвестные отметки не попадали в JSON
+func timePointer(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
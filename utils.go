@@ -2,72 +2,117 @@ package main
 
 import (
 	"archive/zip"
+	"crypto/rand"
+	"encoding/binary"
 	"fmt"
 	"io"
-	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
 )
 
-// CreateZipArchive создает zip-архив с указанными файлами
-func CreateZipArchive(zipPath string, filePaths []string) error {
-	// Создаем директорию для архива, если нужно
-	dir := filepath.Dir(zipPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("не удалось создать директорию %s: %w", dir, err)
-	}
-
-	// Создаем файл архива
-	zipFile, err := os.Create(zipPath)
-	if err != nil {
-		return fmt.Errorf("не удалось создать файл архива: %w", err)
-	}
-	defer zipFile.Close()
+// CreateZipArchive создает в хранилище zip-архив с указанными объектами.
+// Архив формируется потоком, без промежуточного файла.
+func CreateZipArchive(storage Storage, zipKey string, keys []string) error {
+	reader, writer := io.Pipe()
+	go func() {
+		// Создаем zip writer
+		zipWriter := zip.NewWriter(writer)
 
-	// Создаем zip writer
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
-
-	// Добавляем файлы в архив
-	for _, filePath := range filePaths {
-		if err := addFileToZip(zipWriter, filePath); err != nil {
-			return err
+		// Добавляем файлы в архив
+		for _, key := range keys {
+			if err := addFileToZip(zipWriter, storage, key); err != nil {
+				writer.CloseWithError(err)
+				return
+			}
 		}
-	}
+		writer.CloseWithError(zipWriter.Close())
+	}()
 
-	return nil
-}
-
-// addFileToZip добавляет файл в zip архив
-func addFileToZip(zipWriter *zip.Writer, filePath string) error {
-	// Проверяем существование файла
-	fileInfo, err := os.Stat(filePath)
+	err := storage.Put(zipKey, reader)
+	// Если запись прервана, генератор архива не должен остаться заблокированным
+	reader.CloseWithError(io.ErrClosedPipe)
 	if err != nil {
-		return fmt.Errorf("ошибка получения информации о файле %s: %w", filePath, err)
-	}
-
-	// Проверяем, что это файл, а не директория
-	if fileInfo.IsDir() {
-		return fmt.Errorf("%s является директорией, а не файлом", filePath)
+		return fmt.Errorf("не удалось создать архив %s: %w", zipKey, err)
 	}
+	return nil
+}
 
-	// Открываем файл для чтения
-	file, err := os.Open(filePath)
+// addFileToZip добавляет объект хранилища в zip архив под его именем файла
+func addFileToZip(zipWriter *zip.Writer, storage Storage, key string) error {
+	// Открываем объект для чтения
+	file, err := storage.Get(key)
 	if err != nil {
-		return fmt.Errorf("не удалось открыть файл %s: %w", filePath, err)
+		return fmt.Errorf("не удалось открыть файл %s: %w", key, err)
 	}
 	defer file.Close()
 
 	// Создаем файл внутри архива
-	baseFileName := filepath.Base(filePath)
-	zipFile, err := zipWriter.Create(baseFileName)
+	zipFile, err := zipWriter.Create(path.Base(key))
 	if err != nil {
 		return fmt.Errorf("не удалось создать файл в архиве: %w", err)
 	}
 
 	// Копируем содержимое файла в архив
 	if _, err := io.Copy(zipFile, file); err != nil {
-		return fmt.Errorf("ошибка копирования файла в архив: %w", err)
+		return fmt.Errorf("ошибка копирования файла %s в архив: %w", key, err)
 	}
 
 	return nil
 }
+
+// contains проверяет наличие строки в списке
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadExtension возвращает расширение загруженного файла в нижнем регистре
+// для имени файла в хранилище; слишком длинное расширение отбрасывается
+func uploadExtension(name string) string {
+	ext := strings.ToLower(filepath.Ext(sanitizeFileName(name)))
+	if len(ext) > 10 {
+		return ""
+	}
+	return ext
+}
+
+// sanitizeFileName оставляет от имени файла только безопасные символы,
+// исключая разделители пути и управляющие символы
+func sanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	safe := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+
+	safe = strings.TrimLeft(safe, ".")
+	if runes := []rune(safe); len(runes) > 100 {
+		ext := filepath.Ext(safe)
+		if len([]rune(ext)) > 10 {
+			ext = ""
+		}
+		safe = string(runes[:100-len([]rune(ext))]) + ext
+	}
+	if safe == "" {
+		safe = "file"
+	}
+	return safe
+}
+
+// newSeed возвращает случайное зерно для перемешивания порядка в сессии
+func newSeed() int64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return time.Now().UnixNano()
+	}
+	return int64(binary.LittleEndian.Uint64(b[:]))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// surveyDataset — строки сводного набора версии опроса вместе с ее
+// определением. Header — заголовок набора, Rows — строки без заголовка.
+type surveyDataset struct {
+	Survey *Survey
+	Header []string
+	Rows   [][]string
+}
+
+// responsesWorkbook формирует книгу Excel с ответами: по листу на каждый опрос
+// с типизированными ячейками, кодификатор вопросов и лист сессий со временем
+// прохождения и ссылками на аудиозаписи
+func responsesWorkbook(datasets []surveyDataset, optionFormat string) []XLSXSheet {
+	var sheets []XLSXSheet
+	codebook := XLSXSheet{Name: "Кодификатор", Header: true, Rows: [][]interface{}{{
+		"Опрос", "Версия", "Вопрос ID", "Текст вопроса", "Тип вопроса", "Обязательный",
+		"Варианты ответа", "Строки", "Единица", "Столбцы набора",
+	}}}
+	sessions := XLSXSheet{Name: "Сессии", Header: true, Rows: [][]interface{}{{
+		"Опрос", "Версия", "Сессия", "Язык", "Начало", "Первое действие", "Отправка", "Длительность, с", "Аудио",
+	}}}
+
+	for _, dataset := range datasets {
+		survey := dataset.Survey
+		columns := datasetColumns(survey.Questions, optionFormat)
+		kinds := make(map[string]columnKind, len(columns))
+		names := make(map[string][]string)
+		for _, column := range columns {
+			kinds[column.Name] = column.Kind
+			names[column.Question] = append(names[column.Question], column.Name)
+		}
+		kinds["started_at"], kinds["first_interaction_at"], kinds["submitted_at"] = columnDateTime, columnDateTime, columnDateTime
+		kinds["duration_seconds"] = columnNumber
+
+		// Ячейки сопоставляются по заголовку набора, а не по позиции
+		responses := XLSXSheet{Name: survey.ID, Header: true}
+		header := make([]interface{}, len(dataset.Header))
+		for i, name := range dataset.Header {
+			header[i] = name
+		}
+		responses.Rows = append(responses.Rows, header)
+		for _, row := range dataset.Rows {
+			cells := make([]interface{}, len(row))
+			meta := make(map[string]interface{})
+			for i, raw := range row {
+				if i >= len(dataset.Header) {
+					break
+				}
+				name := dataset.Header[i]
+				cells[i] = typedCell(kinds[name], raw)
+				if name == "audio" && raw != "" {
+					cells[i] = XLSXLink{Target: raw, Text: raw}
+				}
+				meta[name] = cells[i]
+			}
+			responses.Rows = append(responses.Rows, cells)
+			sessions.Rows = append(sessions.Rows, []interface{}{
+				survey.ID, survey.Version, meta["session_id"], meta["language"],
+				meta["started_at"], meta["first_interaction_at"], meta["submitted_at"], meta["duration_seconds"], meta["audio"],
+			})
+		}
+		sheets = append(sheets, responses)
+
+		for _, q := range survey.Questions {
+			options := q.Options
+			if q.Type == TypeMatrix {
+				options = q.Columns
+			}
+			labels := make([]string, len(options))
+			for i, option := range options {
+				labels[i] = option.Value
+				if option.Label != option.Value {
+					labels[i] += " = " + option.Label
+				}
+			}
+			codebook.Rows = append(codebook.Rows, []interface{}{
+				survey.ID, survey.Version, q.ID, q.Text, string(q.Type), q.Required,
+				strings.Join(labels, "; "), strings.Join(q.Rows, "; "), q.Unit, strings.Join(names[q.ID], ", "),
+			})
+		}
+	}
+
+	return append(sheets, codebook, sessions)
+}
+
+// typedCell преобразует значение сводного набора в ячейку нужного типа.
+// Значения, которые не удалось разобрать, выгружаются текстом.
+func typedCell(kind columnKind, raw string) interface{} {
+	if raw == "" {
+		return nil
+	}
+	switch kind {
+	case columnNumber, columnDuration:
+		if value, err := strconv.ParseFloat(raw, 64); err == nil {
+			return value
+		}
+	case columnDate:
+		if value, err := time.Parse(exportDateFormat, raw); err == nil {
+			return XLSXDate(value)
+		}
+	case columnDateTime:
+		if value, err := time.Parse(exportDateTimeFormat, raw); err == nil {
+			return value
+		}
+	}
+	return raw
+}
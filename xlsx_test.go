@@ -0,0 +1,205 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// xlsxCell — ячейка листа, прочитанная из пакета
+type xlsxCell struct {
+	Ref     string `xml:"r,attr"`
+	Type    string `xml:"t,attr"`
+	Style   string `xml:"s,attr"`
+	Value   string `xml:"v"`
+	Inline  string `xml:"is>t"`
+	Formula string `xml:"f"`
+}
+
+// readXLSX проверяет, что книга — корректный пакет Office Open XML: все
+// части разбираются как XML, а листы из workbook.xml есть в пакете и в
+// [Content_Types].xml. Возвращает ячейки листов по их именам.
+func readXLSX(t *testing.T, data []byte) ([]string, map[string]map[string]xlsxCell) {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("книга не является zip-архивом: %v", err)
+	}
+	parts := make(map[string][]byte)
+	for _, file := range reader.File {
+		body, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoder := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("часть %s не разбирается как XML: %v", file.Name, err)
+			}
+		}
+		parts[file.Name] = content
+	}
+
+	var types struct {
+		Overrides []struct {
+			PartName string `xml:"PartName,attr"`
+		} `xml:"Override"`
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	for name, target := range map[string]interface{}{
+		"[Content_Types].xml": &types, "xl/_rels/workbook.xml.rels": &rels, "xl/workbook.xml": &workbook,
+	} {
+		if err := xml.Unmarshal(parts[name], target); err != nil {
+			t.Fatalf("часть %s: %v", name, err)
+		}
+	}
+	if _, ok := parts["_rels/.rels"]; !ok {
+		t.Error("в пакете нет _rels/.rels")
+	}
+	declared := make(map[string]bool)
+	for _, override := range types.Overrides {
+		declared[strings.TrimPrefix(override.PartName, "/")] = true
+		if _, ok := parts[strings.TrimPrefix(override.PartName, "/")]; !ok {
+			t.Errorf("часть %s объявлена, но отсутствует", override.PartName)
+		}
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels.Relationships {
+		targets[rel.ID] = path.Join("xl", rel.Target)
+	}
+
+	var names []string
+	sheets := make(map[string]map[string]xlsxCell)
+	for _, sheet := range workbook.Sheets {
+		part := targets[sheet.RID]
+		if !declared[part] {
+			t.Errorf("лист %s: часть %q не объявлена в [Content_Types].xml", sheet.Name, part)
+		}
+		var content struct {
+			Cells []xlsxCell `xml:"sheetData>row>c"`
+		}
+		if err := xml.Unmarshal(parts[part], &content); err != nil {
+			t.Fatalf("лист %s: %v", sheet.Name, err)
+		}
+		cells := make(map[string]xlsxCell)
+		for _, cell := range content.Cells {
+			cells[cell.Ref] = cell
+		}
+		names = append(names, sheet.Name)
+		sheets[sheet.Name] = cells
+	}
+	return names, sheets
+}
+
+func TestWriteXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteXLSX(&buf, []XLSXSheet{{
+		Name:   "Итоги [2024]/Q1: очень длинное название листа",
+		Header: true,
+		Rows: [][]interface{}{
+			{"Текст", "Число", "Дата"},
+			{`<a & "b">`, 2.5, XLSXDate(time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC))},
+			{nil, 7, time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC), true, XLSXLink{Target: `audio "1".wav`, Text: "audio"}},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, sheets := readXLSX(t, buf.Bytes())
+	name := "Итоги _2024__Q1_ очень длинное "
+	if len(names) != 1 || names[0] != name {
+		t.Fatalf("листы %q, ожидался %q", names, name)
+	}
+	cells := sheets[name]
+	for ref, want := range map[string]xlsxCell{
+		"A1": {Type: "inlineStr", Style: "3", Inline: "Текст"},
+		"A2": {Type: "inlineStr", Inline: `<a & "b">`},
+		"B2": {Value: "2.5"},
+		"C2": {Style: "1", Value: "45356"},
+		"B3": {Value: "7"},
+		"C3": {Style: "2", Value: "45356.5"},
+		"D3": {Type: "b", Value: "1"},
+		"E3": {Type: "str", Style: "4", Formula: `HYPERLINK("audio ""1"".wav","audio")`, Value: "audio"},
+	} {
+		want.Ref = ref
+		if got := cells[ref]; got != want {
+			t.Errorf("ячейка %s: %+v, ожидалось %+v", ref, got, want)
+		}
+	}
+	if _, ok := cells["A3"]; ok {
+		t.Error("пустое значение записано в ячейку")
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumn(i); got != want {
+			t.Errorf("столбец %d: %s, ожидался %s", i, got, want)
+		}
+	}
+}
+
+func TestSaveResponsesXLSX(t *testing.T) {
+	sm := newTestManager(t, `{
+		"smtp_host": "127.0.0.1", "smtp_port": 1,
+		"email": {"to": "a@example.com", "from": "a@example.com"},
+		"export": {"formats": ["xlsx"]},
+		"questions": [
+			{"id": "age", "text": "Возраст", "type": "number"},
+			{"id": "fruit", "text": "Фрукт", "type": "single_choice", "options": [{"value": "a", "label": "Яблоко"}]}
+		]
+	}`)
+	session := sm.newSession(sm.currentConfig().Surveys[0])
+	session.SubmitTime = time.Now()
+	session.Responses = map[string][]string{"age": {"42"}, "fruit": {"a"}}
+	session.Typed = map[string]interface{}{"age": 42.0}
+	if err := sm.responseHandler.SaveResponses(session, sm.currentConfig().Export); err != nil {
+		t.Fatal(err)
+	}
+
+	data := readObject(t, sm.responseHandler.storage, sm.responseHandler.responseKey(session, ExportFormatXLSX))
+	names, sheets := readXLSX(t, []byte(data))
+	if strings.Join(names, ",") != "default,Кодификатор,Сессии" {
+		t.Fatalf("листы книги %q", names)
+	}
+	responses := sheets["default"]
+	var ageColumn string
+	for i := 0; i < len(responses) && ageColumn == ""; i++ {
+		if responses[xlsxColumn(i)+"1"].Inline == "age" {
+			ageColumn = xlsxColumn(i)
+		}
+	}
+	if cell := responses[ageColumn+"2"]; ageColumn == "" || cell.Type != "" || cell.Value != "42" {
+		t.Errorf("возраст записан ячейкой %+v (столбец %q)", cell, ageColumn)
+	}
+	found := false
+	for _, cell := range sheets["Кодификатор"] {
+		found = found || cell.Inline == "a = Яблоко"
+	}
+	if !found {
+		t.Error("в кодификаторе нет подписи варианта a = Яблоко")
+	}
+}